@@ -3,19 +3,27 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/admin"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/apidocs"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/cache"
 	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
 	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/handlers"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/metrics"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/redact"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/taxonomy"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/tracing"
 	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/validator"
 	"github.com/gorilla/mux"
-	"github.com/microlib/simple"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
@@ -23,65 +31,118 @@ const (
 	APPLICATIONJSON string = "application/json"
 )
 
-var (
-	logger       *simple.Logger
-	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
-		Name: "s3bucket_manager_http_duration_seconds",
-		Help: "Duration of HTTP requests.",
-	}, []string{"path"})
-)
+var logger *logging.Logger
 
-// prometheusMiddleware implements mux.MiddlewareFunc.
-func prometheusMiddleware(next http.Handler) http.Handler {
+// headersMiddleware implements mux.MiddlewareFunc (the request metrics are recorded by metrics.Middleware)
+func headersMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(CONTENTTYPE, APPLICATIONJSON)
 		// use this for cors
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Accept-Language")
-		route := mux.CurrentRoute(r)
-		path, _ := route.GetPathTemplate()
-		timer := prometheus.NewTimer(httpDuration.WithLabelValues(path))
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Accept-Language, X-Request-ID, traceparent, tracestate")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 		next.ServeHTTP(w, r)
-		timer.ObserveDuration()
 	})
 }
 
 // startHttpServer - private function
 func startHttpServer(con connectors.Clients) *http.Server {
-	srv := &http.Server{Addr: ":" + os.Getenv("SERVER_PORT")}
-
 	r := mux.NewRouter()
+	// the router is the server handler (not the default mux) so nothing registered on the default mux is public
+	srv := &http.Server{Addr: ":" + os.Getenv("SERVER_PORT"), Handler: r}
 
-	r.Use(prometheusMiddleware)
-	r.Path("/api/v2/metrics").Handler(promhttp.Handler())
+	// the tracing middleware runs first so the request span covers the whole request (and joins the caller's trace)
+	// then the request id middleware so every log line of the request has the id
+	r.Use(tracing.Middleware)
+	r.Use(logging.Middleware)
+	r.Use(metrics.Middleware)
+	r.Use(headersMiddleware)
 
 	r.HandleFunc("/api/v1/list/reports/{offset}/{limit}", func(w http.ResponseWriter, req *http.Request) {
-		handlers.ListHandler(w, req, con)
+		handlers.ListHandler(w, req, con.WithContext(req.Context()))
 	}).Methods("POST", "OPTIONS")
 
 	r.HandleFunc("/api/v1/reports/count", func(w http.ResponseWriter, req *http.Request) {
-		handlers.ReportCountHandler(w, req, con)
+		handlers.ReportCountHandler(w, req, con.WithContext(req.Context()))
 	}).Methods("POST", "OPTIONS")
 
 	r.HandleFunc("/api/v1/reports", func(w http.ResponseWriter, req *http.Request) {
-		handlers.ReportUpdateHandler(w, req, con)
+		handlers.ReportUpdateHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/reports/bulk", func(w http.ResponseWriter, req *http.Request) {
+		handlers.BulkUpdateHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/reports/{id}", func(w http.ResponseWriter, req *http.Request) {
+		handlers.ReportPatchHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("PATCH", "OPTIONS")
+
+	r.HandleFunc("/api/v1/audit/reports/{id}/{offset}/{limit}", func(w http.ResponseWriter, req *http.Request) {
+		handlers.AuditHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/audit/users/{user}/{offset}/{limit}", func(w http.ResponseWriter, req *http.Request) {
+		handlers.AuditHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/labels", func(w http.ResponseWriter, req *http.Request) {
+		handlers.LabelsHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/labels/{affiliate}", func(w http.ResponseWriter, req *http.Request) {
+		handlers.LabelsHandler(w, req, con.WithContext(req.Context()))
 	}).Methods("POST", "OPTIONS")
 
 	r.HandleFunc("/api/v1/stats", func(w http.ResponseWriter, req *http.Request) {
-		handlers.StatsHandler(w, req, con)
+		handlers.StatsHandler(w, req, con.WithContext(req.Context()))
 	}).Methods("POST", "OPTIONS")
 
 	r.HandleFunc("/api/v1/s3bucket/report", func(w http.ResponseWriter, req *http.Request) {
-		handlers.ReportObjectHandler(w, req, con)
+		handlers.ReportObjectHandler(w, req, con.WithContext(req.Context()))
 	}).Methods("POST", "OPTIONS")
 
-	r.HandleFunc("/api/v2/sys/info/isalive", handlers.IsAlive).Methods("GET")
+	r.HandleFunc("/api/v1/s3bucket/report/versions", func(w http.ResponseWriter, req *http.Request) {
+		handlers.ReportVersionsHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
 
-	sh := http.StripPrefix("/api/v2/api-docs/", http.FileServer(http.Dir("./swaggerui/")))
-	r.PathPrefix("/api/v2/api-docs/").Handler(sh)
+	r.HandleFunc("/api/v1/s3bucket/report/versions/{version}", func(w http.ResponseWriter, req *http.Request) {
+		handlers.ReportVersionHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
 
-	http.Handle("/", r)
+	r.HandleFunc("/api/v1/s3bucket/report/diff/{from}/{to}", func(w http.ResponseWriter, req *http.Request) {
+		handlers.ReportDiffHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/s3bucket/reports", func(w http.ResponseWriter, req *http.Request) {
+		handlers.BatchReportHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/s3bucket/browse", func(w http.ResponseWriter, req *http.Request) {
+		handlers.BrowseHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/s3bucket/email", func(w http.ResponseWriter, req *http.Request) {
+		handlers.EmailHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/s3bucket/email/attachment/{index}", func(w http.ResponseWriter, req *http.Request) {
+		handlers.EmailAttachmentHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/s3bucket/presign", func(w http.ResponseWriter, req *http.Request) {
+		handlers.PresignHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST", "OPTIONS")
+
+	r.HandleFunc("/api/v1/ingest/s3event", func(w http.ResponseWriter, req *http.Request) {
+		handlers.IngestHandler(w, req, con.WithContext(req.Context()))
+	}).Methods("POST")
+
+	r.HandleFunc("/api/v2/sys/info/isalive", handlers.IsAlive).Methods("GET")
+
+	// the openapi spec and the swagger ui are embedded in the binary (see pkg/apidocs)
+	r.PathPrefix(apidocs.PREFIX).Handler(apidocs.Handler()).Methods("GET")
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil {
@@ -92,13 +153,66 @@ func startHttpServer(con connectors.Clients) *http.Server {
 	return srv
 }
 
+// runCommand - private function, runs a subcommand (reconcile, backfill or migrate) and returns the exit code
+func runCommand(con connectors.Clients, args []string) int {
+	switch args[0] {
+	case "reconcile":
+		fs := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+		// like the scheduled job the command only reports the drift, repairs need an explicit -dry-run=false
+		dryRun := fs.Bool("dry-run", true, "only report the drift, use -dry-run=false to move the orphans and remove them from servisbotstats")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		report, err := handlers.Reconcile(con, *dryRun)
+		if err != nil {
+			con.Error("reconcile : %v", err)
+			return 1
+		}
+		b, _ := json.MarshalIndent(report, "", "	")
+		fmt.Println(string(b))
+		if report.Failed > 0 {
+			return 1
+		}
+		return 0
+	case "backfill", "migrate":
+		// migrate is a backfill of the existing documents (the bot owned fields, i.e the email summary, are updated)
+		opts := handlers.BackfillOptions{}
+		fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+		fs.StringVar(&opts.Bucket, "bucket", os.Getenv("AWS_BUCKET"), "the report bucket")
+		fs.StringVar(&opts.Prefix, "prefix", "", "the object key prefix (default every channel prefix)")
+		fs.IntVar(&opts.Workers, "workers", 8, "the number of objects processed in parallel")
+		fs.IntVar(&opts.Rate, "rate", 50, fmt.Sprintf("the maximum number of objects per second (0 is unlimited, at most %d)", handlers.BACKFILLMAXRATE))
+		fs.StringVar(&opts.Checkpoint, "checkpoint", args[0]+"-checkpoint.json", "the checkpoint file used to resume")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		if err := opts.Validate(); err != nil {
+			con.Error("%s : %v", args[0], err)
+			return 2
+		}
+		report, err := handlers.Backfill(con, opts)
+		b, _ := json.MarshalIndent(report, "", "	")
+		fmt.Println(string(b))
+		if err != nil {
+			con.Error("%s : %v", args[0], err)
+			return 1
+		}
+		if report.Failed > 0 {
+			return 1
+		}
+		return 0
+	}
+	con.Error("unknown command %s (use reconcile, backfill or migrate)", args[0])
+	return 2
+}
+
 // main - no need for any explanation
 func main() {
 
 	if os.Getenv("LOG_LEVEL") == "" {
-		logger = &simple.Logger{Level: "info"}
+		logger = &logging.Logger{Level: "info"}
 	} else {
-		logger = &simple.Logger{Level: os.Getenv("LOG_LEVEL")}
+		logger = &logging.Logger{Level: os.Getenv("LOG_LEVEL")}
 	}
 
 	err := validator.ValidateEnvars(logger)
@@ -106,10 +220,55 @@ func main() {
 		os.Exit(-1)
 	}
 
+	err = taxonomy.Init(logger)
+	if err != nil {
+		os.Exit(-1)
+	}
+
+	err = redact.Init(logger)
+	if err != nil {
+		os.Exit(-1)
+	}
+
+	err = cache.Init(logger)
+	if err != nil {
+		os.Exit(-1)
+	}
+
+	err = tracing.Init(logger)
+	if err != nil {
+		os.Exit(-1)
+	}
+
+	err = metrics.Init(logger)
+	if err != nil {
+		os.Exit(-1)
+	}
+
 	conn := connectors.NewClientConnections(logger)
 
+	// subcommands run once and exit (i.e from a cronjob)
+	if len(os.Args) > 1 {
+		code := runCommand(conn, os.Args[1:])
+		tracing.Shutdown(context.Background())
+		os.Exit(code)
+	}
+
+	stop := make(chan struct{})
+	go handlers.ReconcileJob(conn, stop)
+	go handlers.BusinessMetricsJob(conn, stop)
+
 	srv := startHttpServer(conn)
 	logger.Info("Starting server on port " + srv.Addr)
+
+	// metrics, pprof and the runtime controls are on the internal admin listener (pprof and the controls need ADMIN_TOKEN)
+	adminSrv := admin.NewServer(logger)
+	go func() {
+		if err := adminSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Error("Admin listener : ListenAndServe() error: " + err.Error())
+		}
+	}()
+	logger.Info("Starting admin listener on port " + adminSrv.Addr)
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
@@ -134,10 +293,15 @@ func main() {
 	}()
 
 	code := <-exit_chan
+	close(stop)
 
 	if err := srv.Shutdown(nil); err != nil {
 		panic(err)
 	}
+	adminSrv.Shutdown(context.Background())
+	if err := tracing.Shutdown(context.Background()); err != nil {
+		logger.Error("Tracing : shutdown " + err.Error())
+	}
 	logger.Info("Server shutdown successfully")
 	os.Exit(code)
 }
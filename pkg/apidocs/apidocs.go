@@ -0,0 +1,42 @@
+package apidocs
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+)
+
+const (
+	PREFIX          string = "/api/v2/api-docs/"
+	SPECFILE        string = "openapi.json"
+	CONTENTTYPE     string = "Content-Type"
+	APPLICATIONJSON string = "application/json"
+)
+
+// Spec - the openapi 3 document of the public api (every route and every pkg/schema type)
+// TestSpec fails when a route or a schema field is added without updating it
+//
+//go:embed openapi.json
+var Spec []byte
+
+// ui - the swagger ui page and the (vendored) swagger ui dist files, see swaggerui/NOTICE
+//
+//go:embed swaggerui
+var ui embed.FS
+
+// Handler - serves the swagger ui (PREFIX) and the spec (PREFIX + openapi.json) from the binary
+// mount it with the router PathPrefix(PREFIX)
+func Handler() http.Handler {
+	static, _ := fs.Sub(ui, "swaggerui")
+	files := http.FileServer(http.FS(static))
+	return http.StripPrefix(PREFIX, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == SPECFILE {
+			w.Header().Set(CONTENTTYPE, APPLICATIONJSON)
+			w.Write(Spec)
+			return
+		}
+		// the api middleware sets a json content type, the file server only sets it (by extension) when it is not set
+		w.Header().Del(CONTENTTYPE)
+		files.ServeHTTP(w, r)
+	}))
+}
@@ -0,0 +1,294 @@
+package apidocs
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const (
+	MAINFILE   string = "../../cmd/microservice/main.go"
+	SCHEMAFILE string = "../schema/schema.go"
+	REFPREFIX  string = "#/components/schemas/"
+)
+
+// openAPI - test helper, the parts of the spec that are checked
+type openAPI struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]*schemaObject `json:"schemas"`
+	} `json:"components"`
+}
+
+// schemaObject - test helper
+type schemaObject struct {
+	Ref        string                   `json:"$ref"`
+	Properties map[string]*schemaObject `json:"properties"`
+	AllOf      []*schemaObject          `json:"allOf"`
+}
+
+// structField - test helper, a json field of a go struct (nested is set for anonymous structs)
+type structField struct {
+	name   string
+	nested []structField
+}
+
+// loadSpec - test helper
+func loadSpec(t *testing.T, b []byte) *openAPI {
+	var spec *openAPI
+	if err := json.Unmarshal(b, &spec); err != nil {
+		t.Fatalf(fmt.Sprintf("Spec is not valid json - got (%v) wanted (%v)", err, nil))
+	}
+	return spec
+}
+
+// routes - test helper, the method and path of every route registered (with HandleFunc) in main.go
+// OPTIONS is the cors preflight and is not documented
+func routes(t *testing.T) []string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, MAINFILE, nil, 0)
+	if err != nil {
+		t.Fatalf(fmt.Sprintf("Could not parse %s - got (%v) wanted (%v)", MAINFILE, err, nil))
+	}
+	var result []string
+	ast.Inspect(f, func(n ast.Node) bool {
+		methods, ok := n.(*ast.CallExpr)
+		if !ok || selector(methods.Fun) != "Methods" {
+			return true
+		}
+		handle, ok := methods.Fun.(*ast.SelectorExpr).X.(*ast.CallExpr)
+		if !ok || selector(handle.Fun) != "HandleFunc" {
+			return true
+		}
+		path, _ := strconv.Unquote(handle.Args[0].(*ast.BasicLit).Value)
+		for _, arg := range methods.Args {
+			method, _ := strconv.Unquote(arg.(*ast.BasicLit).Value)
+			if method != http.MethodOptions {
+				result = append(result, method+" "+path)
+			}
+		}
+		return true
+	})
+	return result
+}
+
+// selector - test helper, the selected name (i.e HandleFunc for r.HandleFunc)
+func selector(e ast.Expr) string {
+	if s, ok := e.(*ast.SelectorExpr); ok {
+		return s.Sel.Name
+	}
+	return ""
+}
+
+// types - test helper, the json fields of every struct type in the schema package
+func types(t *testing.T) map[string][]structField {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, SCHEMAFILE, nil, 0)
+	if err != nil {
+		t.Fatalf(fmt.Sprintf("Could not parse %s - got (%v) wanted (%v)", SCHEMAFILE, err, nil))
+	}
+	result := make(map[string][]structField)
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if st, ok := ts.Type.(*ast.StructType); ok {
+				result[ts.Name.Name] = fields(st)
+			}
+		}
+	}
+	return result
+}
+
+// fields - test helper, embedded structs are skipped (their fields are checked with their own type)
+func fields(st *ast.StructType) []structField {
+	var result []structField
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			continue
+		}
+		name := field.Names[0].Name
+		if field.Tag != nil {
+			tag, _ := strconv.Unquote(field.Tag.Value)
+			if jsonName := strings.Split(reflect.StructTag(tag).Get("json"), ",")[0]; jsonName == "-" {
+				continue
+			} else if jsonName != "" {
+				name = jsonName
+			}
+		}
+		sf := structField{name: name}
+		if nested, ok := field.Type.(*ast.StructType); ok {
+			sf.nested = fields(nested)
+		}
+		result = append(result, sf)
+	}
+	return result
+}
+
+// missingRoutes - test helper, the routes that are not in the spec and the spec operations that are not routes
+func missingRoutes(spec *openAPI, routes []string) []string {
+	var missing []string
+	registered := make(map[string]bool)
+	for _, route := range routes {
+		registered[route] = true
+		parts := strings.SplitN(route, " ", 2)
+		if _, ok := spec.Paths[parts[1]][strings.ToLower(parts[0])]; !ok {
+			missing = append(missing, "route "+route)
+		}
+	}
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			if route := strings.ToUpper(method) + " " + path; !registered[route] {
+				missing = append(missing, "spec "+route)
+			}
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// missingFields - test helper, the types and json fields that are not in the spec components
+func missingFields(spec *openAPI, types map[string][]structField) []string {
+	var missing []string
+	for name, fields := range types {
+		schema, ok := spec.Components.Schemas[name]
+		if !ok {
+			missing = append(missing, "type "+name)
+			continue
+		}
+		missing = append(missing, missingProperties(spec, name, properties(spec, schema), fields)...)
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// missingProperties - test helper
+func missingProperties(spec *openAPI, path string, props map[string]*schemaObject, fields []structField) []string {
+	var missing []string
+	for _, field := range fields {
+		prop, ok := props[field.name]
+		if !ok {
+			missing = append(missing, "field "+path+"."+field.name)
+			continue
+		}
+		if field.nested != nil {
+			missing = append(missing, missingProperties(spec, path+"."+field.name, properties(spec, prop), field.nested)...)
+		}
+	}
+	return missing
+}
+
+// properties - test helper, the properties of the schema (with the properties of its allOf schemas)
+func properties(spec *openAPI, schema *schemaObject) map[string]*schemaObject {
+	result := make(map[string]*schemaObject)
+	if schema.Ref != "" {
+		if ref, ok := spec.Components.Schemas[strings.TrimPrefix(schema.Ref, REFPREFIX)]; ok {
+			return properties(spec, ref)
+		}
+	}
+	for name, prop := range schema.Properties {
+		result[name] = prop
+	}
+	for _, all := range schema.AllOf {
+		for name, prop := range properties(spec, all) {
+			result[name] = prop
+		}
+	}
+	return result
+}
+
+// TestApiDocs - test entry point
+func TestApiDocs(t *testing.T) {
+
+	t.Run("Spec : should pass (openapi 3 and every $ref resolves)", func(t *testing.T) {
+		spec := loadSpec(t, Spec)
+		if !strings.HasPrefix(spec.OpenAPI, "3.") {
+			t.Errorf(fmt.Sprintf("Spec has an incorrect version - got (%s) wanted (%s)", spec.OpenAPI, "3.x"))
+		}
+		for _, ref := range regexp.MustCompile(`"\$ref": "([^"]+)"`).FindAllSubmatch(Spec, -1) {
+			name := strings.TrimPrefix(string(ref[1]), REFPREFIX)
+			if _, ok := spec.Components.Schemas[name]; !ok && !strings.HasPrefix(string(ref[1]), "#/components/responses/") {
+				t.Errorf(fmt.Sprintf("Spec has an unresolved reference - got (%s) wanted (%s)", ref[1], "a component"))
+			}
+		}
+	})
+
+	t.Run("Spec : should pass (every route in main.go is documented)", func(t *testing.T) {
+		spec := loadSpec(t, Spec)
+		registered := routes(t)
+		if len(registered) == 0 {
+			t.Fatalf(fmt.Sprintf("No routes found in %s - got (%d) wanted (%s)", MAINFILE, len(registered), "> 0"))
+		}
+		if missing := missingRoutes(spec, registered); len(missing) > 0 {
+			t.Errorf(fmt.Sprintf("Spec is out of date - got (%s) wanted (%v)", strings.Join(missing, ", "), nil))
+		}
+	})
+
+	t.Run("Spec : should pass (every pkg/schema type and json field is documented)", func(t *testing.T) {
+		spec := loadSpec(t, Spec)
+		if missing := missingFields(spec, types(t)); len(missing) > 0 {
+			t.Errorf(fmt.Sprintf("Spec is out of date - got (%s) wanted (%v)", strings.Join(missing, ", "), nil))
+		}
+	})
+
+	t.Run("Spec : should fail (route and field missing)", func(t *testing.T) {
+		spec := loadSpec(t, Spec)
+		delete(spec.Paths, "/api/v1/stats")
+		delete(spec.Components.Schemas["StatsResponse"].Properties, "confusionmatrix")
+		delete(spec.Components.Schemas["ConfusionMatrix"].Properties["cancel"].Properties, "cancelar")
+		missing := append(missingRoutes(spec, routes(t)), missingFields(spec, types(t))...)
+		expected := []string{"route POST /api/v1/stats", "field ConfusionMatrix.cancel.cancelar", "field StatsResponse.confusionmatrix"}
+		if !reflect.DeepEqual(missing, expected) {
+			t.Errorf(fmt.Sprintf("Spec check returned incorrect data - got (%v) wanted (%v)", missing, expected))
+		}
+	})
+
+	t.Run("Handler : should pass (swagger ui and spec)", func(t *testing.T) {
+		handler := Handler()
+		tests := []struct {
+			path        string
+			contentType string
+			contains    string
+		}{
+			{PREFIX, "text/html", "SwaggerUIBundle"},
+			{PREFIX + SPECFILE, APPLICATIONJSON, `"openapi"`},
+			{PREFIX + "swagger-ui-bundle.js", "javascript", "SwaggerUIBundle"},
+			{PREFIX + "swagger-ui.css", "text/css", "swagger-ui"},
+		}
+		for _, tt := range tests {
+			rr := httptest.NewRecorder()
+			// the api middleware has already set a json content type
+			rr.Header().Set(CONTENTTYPE, APPLICATIONJSON)
+			req, _ := http.NewRequest("GET", tt.path, nil)
+			handler.ServeHTTP(rr, req)
+			body, _ := ioutil.ReadAll(rr.Body)
+			if rr.Code != http.StatusOK || !strings.Contains(rr.Header().Get(CONTENTTYPE), tt.contentType) || !strings.Contains(string(body), tt.contains) {
+				t.Errorf(fmt.Sprintf("Handler %s returned incorrect data - got (%d %s) wanted (%d %s)", tt.path, rr.Code, rr.Header().Get(CONTENTTYPE), http.StatusOK, tt.contentType))
+			}
+		}
+	})
+
+	t.Run("Handler : should fail (not found)", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", PREFIX+"swagger.yaml", nil)
+		Handler().ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Errorf(fmt.Sprintf("Handler returned incorrect status - got (%d) wanted (%d)", rr.Code, http.StatusNotFound))
+		}
+	})
+}
@@ -0,0 +1,20 @@
+package buckets
+
+import "os"
+
+// the couchbase buckets of the service data, the names are shared by the handlers, connectors and cache packages
+// (the stats and transaction buckets are also set by envar)
+const (
+	STATSBUCKET      string = "COUCHBASE_BUCKET"
+	TXNBUCKET        string = "COUCHBASE_TXN_BUCKET"
+	STATS            string = "servisbotstats"
+	AUDIT            string = "servisbotaudit"
+	DEADLETTER       string = "servisbotdeadletter"
+	ORPHANS          string = "servisbotorphans"
+	DEFAULTTXNBUCKET string = "servisbottxn"
+)
+
+// Reserved - the buckets that hold service data (including the envar overrides)
+func Reserved() []string {
+	return []string{STATS, AUDIT, DEADLETTER, ORPHANS, DEFAULTTXNBUCKET, os.Getenv(STATSBUCKET), os.Getenv(TXNBUCKET)}
+}
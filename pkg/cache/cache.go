@@ -0,0 +1,281 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/buckets"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	REPORTCACHEENTRIES = "REPORT_CACHE_ENTRIES"
+	REPORTCACHEBYTES   = "REPORT_CACHE_BYTES"
+	REPORTCACHETTL     = "REPORT_CACHE_TTL"
+	REPORTCACHEBUCKET  = "REPORT_CACHE_BUCKET"
+	DEFAULTENTRIES     = 1000
+	DEFAULTBYTES       = 64 << 20
+	DEFAULTTTL         = 10 * time.Minute
+)
+
+var (
+	requests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "report_cache_requests_total",
+		Help: "Report object cache lookups by tier (local or shared) and result (hit or miss).",
+	}, []string{"tier", "result"})
+	evictions = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "report_cache_evictions_total",
+		Help: "Report objects evicted from the local cache (size or count bound).",
+	})
+	entries = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "report_cache_entries",
+		Help: "Report objects held in the local cache.",
+	})
+	bytes = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "report_cache_bytes",
+		Help: "Size (of the s3 objects) held in the local cache.",
+	})
+)
+
+// Backend - a shared cache (i.e couchbase) used behind the local cache so that all replicas benefit
+// implementations handle their own expiry and must not fail the request (a failure is a miss)
+type Backend interface {
+	Get(key string) (*schema.ReportContent, bool)
+	Set(key string, rc *schema.ReportContent, ttl time.Duration)
+	Delete(key string)
+}
+
+// Cache - in process lru cache of report objects bounded by count and size with a ttl
+// a nil cache is valid (every lookup is a miss) so callers don't need to check if caching is enabled
+type Cache struct {
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   int64
+	ttl        time.Duration
+	size       int64
+	lru        *list.List
+	items      map[string]*list.Element
+	shared     Backend
+	now        func() time.Time
+}
+
+type entry struct {
+	key     string
+	rc      *schema.ReportContent
+	size    int64
+	expires time.Time
+}
+
+var current *Cache
+
+// New - returns an empty cache (maxEntries and maxBytes of 0 are unbounded)
+func New(maxEntries int, maxBytes int64, ttl time.Duration) *Cache {
+	return &Cache{maxEntries: maxEntries, maxBytes: maxBytes, ttl: ttl, lru: list.New(), items: make(map[string]*list.Element), now: time.Now}
+}
+
+// Init - creates the current cache from REPORT_CACHE_ENTRIES, REPORT_CACHE_BYTES and REPORT_CACHE_TTL
+// REPORT_CACHE_ENTRIES=0 disables the cache, REPORT_CACHE_BUCKET (the shared cache) must not be a service data bucket
+func Init(logger *logging.Logger) error {
+	if err := checkBucket(os.Getenv(REPORTCACHEBUCKET)); err != nil {
+		logger.Error(fmt.Sprintf("Report cache : %v", err))
+		return err
+	}
+	maxEntries, err := envInt(REPORTCACHEENTRIES, DEFAULTENTRIES)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Report cache : %v", err))
+		return err
+	}
+	maxBytes, err := envInt(REPORTCACHEBYTES, DEFAULTBYTES)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Report cache : %v", err))
+		return err
+	}
+	ttl := DEFAULTTTL
+	if os.Getenv(REPORTCACHETTL) != "" {
+		ttl, err = time.ParseDuration(os.Getenv(REPORTCACHETTL))
+		if err != nil || ttl <= 0 {
+			err = fmt.Errorf("%s %q is not a valid duration", REPORTCACHETTL, os.Getenv(REPORTCACHETTL))
+			logger.Error(fmt.Sprintf("Report cache : %v", err))
+			return err
+		}
+	}
+	if maxEntries == 0 {
+		logger.Info("Report cache : disabled")
+		Set(nil)
+		return nil
+	}
+	logger.Info(fmt.Sprintf("Report cache : %d entries %d bytes ttl %v", maxEntries, maxBytes, ttl))
+	Set(New(maxEntries, int64(maxBytes), ttl))
+	return nil
+}
+
+// checkBucket - private function, rejects a shared cache bucket that holds service data
+// the shared cache holds unredacted reports so it needs its own bucket, in the stats bucket the cache documents
+// would also be returned by the n1ql queries and moved to the orphans bucket by the reconcile job
+func checkBucket(bucket string) error {
+	if bucket == "" {
+		return nil
+	}
+	for _, reserved := range buckets.Reserved() {
+		if reserved == "" {
+			continue
+		}
+		if strings.EqualFold(bucket, reserved) {
+			return fmt.Errorf("%s %q is a service data bucket, the shared cache needs its own bucket", REPORTCACHEBUCKET, bucket)
+		}
+	}
+	return nil
+}
+
+// Get - returns the current cache (nil when disabled)
+func Get() *Cache {
+	return current
+}
+
+// Set - replaces the current cache
+func Set(c *Cache) {
+	current = c
+}
+
+// Key - the cache key of an s3 object (the version is empty for the latest version)
+func Key(bucket string, key string, version string) string {
+	if version == "" {
+		return bucket + "/" + key
+	}
+	return bucket + "/" + key + "?versionId=" + version
+}
+
+// SetShared - sets the shared backend (looked up on a local miss)
+func (c *Cache) SetShared(b Backend) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.shared = b
+}
+
+// Get - returns a deep copy of the cached report (callers can change the copy)
+func (c *Cache) Get(key string) (*schema.ReportContent, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry)
+		if c.now().Before(e.expires) {
+			c.lru.MoveToFront(el)
+			c.mu.Unlock()
+			requests.WithLabelValues("local", "hit").Inc()
+			return e.rc.Copy(), true
+		}
+		c.remove(el)
+	}
+	shared := c.shared
+	c.mu.Unlock()
+	requests.WithLabelValues("local", "miss").Inc()
+
+	if shared == nil {
+		return nil, false
+	}
+	rc, ok := shared.Get(key)
+	if !ok {
+		requests.WithLabelValues("shared", "miss").Inc()
+		return nil, false
+	}
+	requests.WithLabelValues("shared", "hit").Inc()
+	// the size of a shared hit is unknown so the object counts as 0 bytes locally
+	c.add(key, rc, 0)
+	return rc.Copy(), true
+}
+
+// Put - caches the report (size is the s3 object size) locally and in the shared backend
+func (c *Cache) Put(key string, rc *schema.ReportContent, size int64) {
+	if c == nil || rc == nil {
+		return
+	}
+	// objects larger than the cache are never cached
+	if c.maxBytes > 0 && size > c.maxBytes {
+		return
+	}
+	out := rc.Copy()
+	c.add(key, out, size)
+	c.mu.Lock()
+	shared := c.shared
+	c.mu.Unlock()
+	if shared != nil {
+		shared.Set(key, out, c.ttl)
+	}
+}
+
+// Delete - invalidates the report locally and in the shared backend
+func (c *Cache) Delete(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	shared := c.shared
+	c.mu.Unlock()
+	if shared != nil {
+		shared.Delete(key)
+	}
+}
+
+// Len - returns the number of cached reports
+func (c *Cache) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// add - private function, adds (or replaces) the entry and evicts the least recently used entries
+func (c *Cache) add(key string, rc *schema.ReportContent, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	c.items[key] = c.lru.PushFront(&entry{key: key, rc: rc, size: size, expires: c.now().Add(c.ttl)})
+	c.size += size
+	for (c.maxEntries > 0 && c.lru.Len() > c.maxEntries) || (c.maxBytes > 0 && c.size > c.maxBytes) {
+		c.remove(c.lru.Back())
+		evictions.Inc()
+	}
+	entries.Set(float64(c.lru.Len()))
+	bytes.Set(float64(c.size))
+}
+
+// remove - private function, the caller holds the lock
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.size -= e.size
+	entries.Set(float64(c.lru.Len()))
+	bytes.Set(float64(c.size))
+}
+
+// envInt - private function, returns the envar as an int (or the default when not set)
+func envInt(name string, def int) (int, error) {
+	if os.Getenv(name) == "" {
+		return def, nil
+	}
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("%s %q is not a valid number", name, os.Getenv(name))
+	}
+	return v, nil
+}
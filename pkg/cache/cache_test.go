@@ -0,0 +1,190 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+)
+
+// fakeBackend - in memory shared backend
+type fakeBackend struct {
+	items map[string]*schema.ReportContent
+}
+
+func (f *fakeBackend) Get(key string) (*schema.ReportContent, bool) {
+	rc, ok := f.items[key]
+	return rc, ok
+}
+
+func (f *fakeBackend) Set(key string, rc *schema.ReportContent, ttl time.Duration) {
+	f.items[key] = rc
+}
+
+func (f *fakeBackend) Delete(key string) {
+	delete(f.items, key)
+}
+
+// TestCache - test entry point
+func TestCache(t *testing.T) {
+	logger := &logging.Logger{Level: "trace"}
+
+	t.Run("Get : should pass (hit returns a copy)", func(t *testing.T) {
+		c := New(10, 0, time.Minute)
+		c.Put("a", &schema.ReportContent{EmailSubject: "Cancel"}, 10)
+		got, ok := c.Get("a")
+		if !ok || got.EmailSubject != "Cancel" {
+			t.Fatalf(fmt.Sprintf("Function %s returned incorrect entry - got (%v %v) wanted (%s)", "Get", got, ok, "Cancel"))
+		}
+		got.EmailSubject = "changed"
+		if again, _ := c.Get("a"); again.EmailSubject != "Cancel" {
+			t.Errorf(fmt.Sprintf("Function %s returned a shared entry - got (%s) wanted (%s)", "Get", again.EmailSubject, "Cancel"))
+		}
+	})
+
+	t.Run("Get : should pass (hit returns a deep copy)", func(t *testing.T) {
+		c := New(10, 0, time.Minute)
+		c.Put("a", &schema.ReportContent{
+			Entities: []string{"cancel"},
+			Endpoint: map[string]interface{}{"url": "https://test.com", "tags": []interface{}{"a"}},
+			Chat:     &schema.ChatTranscript{Messages: []schema.ChatMessage{{Text: "hello"}}},
+			Form:     &schema.FormSubmission{Fields: map[string]string{"email": "test@test.com"}},
+		}, 10)
+		got, _ := c.Get("a")
+		got.Entities[0] = "changed"
+		got.Endpoint.(map[string]interface{})["tags"].([]interface{})[0] = "changed"
+		got.Chat.Messages[0].Text = "changed"
+		got.Form.Fields["email"] = "changed"
+		again, _ := c.Get("a")
+		if again.Entities[0] != "cancel" || again.Endpoint.(map[string]interface{})["tags"].([]interface{})[0] != "a" || again.Chat.Messages[0].Text != "hello" || again.Form.Fields["email"] != "test@test.com" {
+			t.Errorf(fmt.Sprintf("Function %s returned a shared entry - got (%v %v %v %v)", "Get", again.Entities, again.Endpoint, again.Chat, again.Form))
+		}
+	})
+
+	t.Run("Put : should pass (least recently used is evicted by count)", func(t *testing.T) {
+		c := New(2, 0, time.Minute)
+		c.Put("a", &schema.ReportContent{}, 1)
+		c.Put("b", &schema.ReportContent{}, 1)
+		c.Get("a")
+		c.Put("c", &schema.ReportContent{}, 1)
+		if _, ok := c.Get("b"); ok || c.Len() != 2 {
+			t.Errorf(fmt.Sprintf("Function %s did not evict the least recently used entry - got (%v %d) wanted (%v %d)", "Put", ok, c.Len(), false, 2))
+		}
+		if _, ok := c.Get("a"); !ok {
+			t.Errorf(fmt.Sprintf("Function %s evicted a recently used entry - got (%v) wanted (%v)", "Put", ok, true))
+		}
+	})
+
+	t.Run("Put : should pass (evicted by size, larger than the cache is not cached)", func(t *testing.T) {
+		c := New(0, 100, time.Minute)
+		c.Put("a", &schema.ReportContent{}, 60)
+		c.Put("b", &schema.ReportContent{}, 60)
+		if _, ok := c.Get("a"); ok {
+			t.Errorf(fmt.Sprintf("Function %s did not evict by size - got (%v) wanted (%v)", "Put", ok, false))
+		}
+		c.Put("c", &schema.ReportContent{}, 101)
+		if _, ok := c.Get("c"); ok || c.Len() != 1 {
+			t.Errorf(fmt.Sprintf("Function %s cached an object larger than the cache - got (%v %d) wanted (%v %d)", "Put", ok, c.Len(), false, 1))
+		}
+	})
+
+	t.Run("Get : should fail (expired)", func(t *testing.T) {
+		now := time.Now()
+		c := New(10, 0, time.Minute)
+		c.now = func() time.Time { return now }
+		c.Put("a", &schema.ReportContent{}, 1)
+		c.now = func() time.Time { return now.Add(2 * time.Minute) }
+		if _, ok := c.Get("a"); ok || c.Len() != 0 {
+			t.Errorf(fmt.Sprintf("Function %s returned an expired entry - got (%v %d) wanted (%v %d)", "Get", ok, c.Len(), false, 0))
+		}
+	})
+
+	t.Run("Delete : should pass (local and shared)", func(t *testing.T) {
+		shared := &fakeBackend{items: map[string]*schema.ReportContent{}}
+		c := New(10, 0, time.Minute)
+		c.SetShared(shared)
+		c.Put("a", &schema.ReportContent{}, 1)
+		if _, ok := shared.items["a"]; !ok {
+			t.Fatalf(fmt.Sprintf("Function %s did not write to the shared backend - got (%v) wanted (%v)", "Put", ok, true))
+		}
+		c.Delete("a")
+		_, local := c.Get("a")
+		_, remote := shared.items["a"]
+		if local || remote {
+			t.Errorf(fmt.Sprintf("Function %s did not invalidate - got (%v %v) wanted (%v %v)", "Delete", local, remote, false, false))
+		}
+	})
+
+	t.Run("Get : should pass (shared hit fills the local cache)", func(t *testing.T) {
+		shared := &fakeBackend{items: map[string]*schema.ReportContent{"a": {EmailSubject: "Cancel"}}}
+		c := New(10, 0, time.Minute)
+		c.SetShared(shared)
+		got, ok := c.Get("a")
+		if !ok || got.EmailSubject != "Cancel" || c.Len() != 1 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect shared entry - got (%v %v %d) wanted (%s %d)", "Get", got, ok, c.Len(), "Cancel", 1))
+		}
+	})
+
+	t.Run("Get : should pass (nil cache is always a miss)", func(t *testing.T) {
+		var c *Cache
+		c.Put("a", &schema.ReportContent{}, 1)
+		c.Delete("a")
+		if _, ok := c.Get("a"); ok || c.Len() != 0 {
+			t.Errorf(fmt.Sprintf("Function %s returned a hit for a nil cache - got (%v) wanted (%v)", "Get", ok, false))
+		}
+	})
+
+	t.Run("Key : should pass", func(t *testing.T) {
+		if got := Key("bucket", "Email/1", ""); got != "bucket/Email/1" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect key - got (%s) wanted (%s)", "Key", got, "bucket/Email/1"))
+		}
+		if got := Key("bucket", "Email/1", "v2"); got != "bucket/Email/1?versionId=v2" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect key - got (%s) wanted (%s)", "Key", got, "bucket/Email/1?versionId=v2"))
+		}
+	})
+
+	t.Run("Init : should pass (envars and disabled)", func(t *testing.T) {
+		os.Setenv(REPORTCACHEENTRIES, "5")
+		os.Setenv(REPORTCACHETTL, "30s")
+		err := Init(logger)
+		if err != nil || Get() == nil || Get().maxEntries != 5 || Get().ttl != 30*time.Second {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect cache - got (%v %v) wanted (%d %v)", "Init", Get(), err, 5, 30*time.Second))
+		}
+		os.Setenv(REPORTCACHEENTRIES, "0")
+		err = Init(logger)
+		if err != nil || Get() != nil {
+			t.Errorf(fmt.Sprintf("Function %s did not disable the cache - got (%v %v) wanted (%v)", "Init", Get(), err, nil))
+		}
+		os.Unsetenv(REPORTCACHEENTRIES)
+		os.Unsetenv(REPORTCACHETTL)
+	})
+
+	t.Run("Init : should fail (invalid envars)", func(t *testing.T) {
+		for name, value := range map[string]string{REPORTCACHEENTRIES: "many", REPORTCACHEBYTES: "-1", REPORTCACHETTL: "soon"} {
+			os.Setenv(name, value)
+			if err := Init(logger); err == nil {
+				t.Errorf(fmt.Sprintf("Function %s returned with no error for %s=%s - got (%v) wanted (%s)", "Init", name, value, err, "error"))
+			}
+			os.Unsetenv(name)
+		}
+	})
+
+	t.Run("Init : should fail (shared cache bucket is a service data bucket)", func(t *testing.T) {
+		os.Setenv("COUCHBASE_BUCKET", "reportstats")
+		defer os.Unsetenv("COUCHBASE_BUCKET")
+		defer os.Unsetenv(REPORTCACHEBUCKET)
+		for _, bucket := range []string{"servisbotstats", "servisbotaudit", "reportstats"} {
+			os.Setenv(REPORTCACHEBUCKET, bucket)
+			if err := Init(logger); err == nil {
+				t.Errorf(fmt.Sprintf("Function %s returned with no error for %s=%s - got (%v) wanted (%s)", "Init", REPORTCACHEBUCKET, bucket, err, "error"))
+			}
+		}
+		os.Setenv(REPORTCACHEBUCKET, "servisbotcache")
+		if err := Init(logger); err != nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with error - got (%v) wanted (%v)", "Init", err, nil))
+		}
+	})
+}
@@ -1,6 +1,9 @@
 package connectors
 
 import (
+	"context"
+	"time"
+
 	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
 	"github.com/aws/aws-sdk-go/service/s3"
 	gocb "github.com/couchbase/gocb/v2"
@@ -12,10 +15,29 @@ type Clients interface {
 	Info(string, ...interface{})
 	Debug(string, ...interface{})
 	Trace(string, ...interface{})
+	TraceBody(string, []byte)
 	Meta(force string) string
+	WithContext(ctx context.Context) Clients
 	GetConfusionMatrix() (*schema.ConfusionMatrix, error)
 	GetList(string, string) ([]schema.ReportList, error)
 	GetListCount() (*int64, error)
+	GetUnreviewedCount() (*int64, error)
+	GetReport(string) (*schema.ReportList, error)
+	GetIds() ([]string, error)
+	GetExisting(ids []string) (map[string]bool, error)
+	GetAuditList(string, string, string, string) ([]schema.AuditRecord, error)
+	Insert(bucket string, uuid string, value interface{}, opts *gocb.InsertOptions) (*gocb.MutationResult, error)
 	Upsert(uuid string, value interface{}, opts *gocb.UpsertOptions) (*gocb.MutationResult, error)
+	Replace(uuid string, value interface{}, opts *gocb.ReplaceOptions) (*gocb.MutationResult, error)
+	Remove(uuid string, opts *gocb.RemoveOptions) (*gocb.MutationResult, error)
+	MutateIn(uuid string, specs []gocb.MutateInSpec, opts *gocb.MutateInOptions) (*gocb.MutateInResult, error)
+	UpdateReports(ids []string, update func(id string, current *schema.ListObject) error) error
 	GetObject(in *s3.GetObjectInput) (*schema.ReportContent, error)
+	GetRawObject(in *s3.GetObjectInput) ([]byte, error)
+	InvalidateObject(in *s3.GetObjectInput)
+	PutObject(in *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+	ListObjects(in *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error)
+	HeadObject(in *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	ListObjectVersions(in *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error)
+	PresignGetObject(in *s3.GetObjectInput, expiry time.Duration) (string, error)
 }
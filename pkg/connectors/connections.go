@@ -1,35 +1,66 @@
 package connectors
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"time"
 
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/buckets"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/cache"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/metrics"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/redact"
 	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/taxonomy"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/tracing"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
 	gocb "github.com/couchbase/gocb/v2"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// SHAREDCACHEPREFIX - the document id prefix of the shared report cache
+	SHAREDCACHEPREFIX string = "reportcache::"
+	// TXNBUCKET - the bucket of the transaction metadata (kept out of the stats bucket so the n1ql queries don't return it)
+	TXNBUCKET        string = buckets.TXNBUCKET
+	DEFAULTTXNBUCKET string = buckets.DEFAULTTXNBUCKET
 )
 
 // Using the +build directive we can plugin (via the receiver) fake or real connectors
+// All log wrappers redact pii (with the current redaction rules) before the line is written
 
 // Error - log wrapper
 func (c *Connectors) Error(msg string, val ...interface{}) {
-	c.Logger.Error(fmt.Sprintf(msg, val...))
+	c.Logger.Error(redact.Log(fmt.Sprintf(msg, val...)))
 }
 
 // Info - log wrapper
 func (c *Connectors) Info(msg string, val ...interface{}) {
-	c.Logger.Info(fmt.Sprintf(msg, val...))
+	c.Logger.Info(redact.Log(fmt.Sprintf(msg, val...)))
 }
 
 // Debug - log wrapper
 func (c *Connectors) Debug(msg string, val ...interface{}) {
-	c.Logger.Debug(fmt.Sprintf(msg, val...))
+	c.Logger.Debug(redact.Log(fmt.Sprintf(msg, val...)))
 }
 
 // Trace - log wrapper
 func (c *Connectors) Trace(msg string, val ...interface{}) {
-	c.Logger.Trace(fmt.Sprintf(msg, val...))
+	c.Logger.Trace(redact.Log(fmt.Sprintf(msg, val...)))
+}
+
+// TraceBody - trace log of a request body (the jwt token and pii fields are masked and the size is capped)
+// the body is only parsed when trace logging is enabled
+func (c *Connectors) TraceBody(msg string, body []byte) {
+	if !c.Logger.Enabled(logging.TRACE) {
+		return
+	}
+	c.Trace(msg, redact.Body(body))
 }
 
 // Meta - used for testing ignored in real implementation
@@ -37,9 +68,76 @@ func (c *Connectors) Meta(force string) string {
 	return force
 }
 
-// GetObject - S3 Object download wrapper
+// WithContext - a copy of the connectors that adds the request id and trace id (if there are any) to every log line
+// so the handler logs and the backend calls it made can be tied together, the backend spans are children of the request span
+func (c *Connectors) WithContext(ctx context.Context) Clients {
+	id := logging.RequestID(ctx)
+	sc := trace.SpanContextFromContext(ctx)
+	if id == "" && !sc.IsValid() {
+		return c
+	}
+	con := *c
+	con.ctx = ctx
+	if id != "" {
+		con.Logger = con.Logger.With(logging.REQUESTID, id)
+	}
+	if sc.IsValid() {
+		con.Logger = con.Logger.With(tracing.TRACEID, sc.TraceID().String())
+	}
+	return &con
+}
+
+// backendCall - private type, the span and start time of a backend call
+type backendCall struct {
+	backend   string
+	operation string
+	start     time.Time
+	span      trace.Span
+}
+
+// startCall - private function, starts the span (named backend.operation) and the timer of a backend call
+func startCall(ctx context.Context, backend string, operation string, attrs ...attribute.KeyValue) (context.Context, *backendCall) {
+	ctx, span := tracing.Start(ctx, backend+"."+operation, attrs...)
+	return ctx, &backendCall{backend: backend, operation: operation, start: time.Now(), span: span}
+}
+
+// end - private function, records the duration (by result) and ends the span
+// pass the address of the error so that it can be deferred before the error is set
+func (b *backendCall) end(err *error) {
+	metrics.ObserveBackend(b.backend, b.operation, time.Since(b.start), *err)
+	tracing.End(b.span, err)
+}
+
+// s3Attributes - private function, the span attributes of an s3 call
+func s3Attributes(bucket *string, key *string) []attribute.KeyValue {
+	return []attribute.KeyValue{semconv.AWSS3Bucket(aws.StringValue(bucket)), semconv.AWSS3Key(aws.StringValue(key))}
+}
+
+// couchbaseAttributes - private function, the span attributes of a couchbase key value call
+func couchbaseAttributes(operation string, id string) []attribute.KeyValue {
+	return []attribute.KeyValue{semconv.DBSystemCouchbase, semconv.DBOperationName(operation), attribute.String("db.couchbase.document_id", id)}
+}
+
+// queryAttributes - private function, the span attributes of a n1ql query (the values are parameters, not in the statement)
+func queryAttributes(operation string, query string) []attribute.KeyValue {
+	return []attribute.KeyValue{semconv.DBSystemCouchbase, semconv.DBOperationName(operation), semconv.DBQueryText(query)}
+}
+
+// GetObject - S3 Object download wrapper (compressed objects are decompressed)
+// reports are served from the cache (if enabled) and cached after the download
 func (c *Connectors) GetObject(opts *s3.GetObjectInput) (*schema.ReportContent, error) {
 	var rc *schema.ReportContent
+	var err error
+	_, call := startCall(c.ctx, "s3", "GetObject", s3Attributes(opts.Bucket, opts.Key)...)
+	defer call.end(&err)
+
+	key := objectCacheKey(opts)
+	if cached, ok := c.Cache.Get(key); ok {
+		c.Trace("Function GetObject cache hit %s", key)
+		call.span.SetAttributes(attribute.Bool("cache.hit", true))
+		return cached, nil
+	}
+
 	result, err := c.S3Service.GetObject(opts)
 	if err != nil {
 		// Message from an error.
@@ -47,9 +145,9 @@ func (c *Connectors) GetObject(opts *s3.GetObjectInput) (*schema.ReportContent,
 		return rc, err
 	}
 
-	b, err := ioutil.ReadAll(result.Body)
+	b, err := readObject(result, maxObjectSize())
 	if err != nil {
-		c.Error("Function GetObject %v", err)
+		c.Error("Function GetObject %s %v", aws.StringValue(opts.Key), err)
 		return rc, err
 	}
 	err = json.Unmarshal(b, &rc)
@@ -58,13 +156,210 @@ func (c *Connectors) GetObject(opts *s3.GetObjectInput) (*schema.ReportContent,
 		return rc, err
 	}
 
+	call.span.SetAttributes(attribute.Bool("cache.hit", false), attribute.Int("s3.object.size", len(b)))
+	c.Cache.Put(key, rc, int64(len(b)))
 	return rc, nil
 }
 
+// InvalidateObject - removes the report from the cache (i.e after it was reclassified or the object was rewritten)
+func (c *Connectors) InvalidateObject(opts *s3.GetObjectInput) {
+	c.Cache.Delete(objectCacheKey(opts))
+}
+
+// objectCacheKey - private function, the cache key of the object (and version) in the input
+func objectCacheKey(opts *s3.GetObjectInput) string {
+	return cache.Key(aws.StringValue(opts.Bucket), aws.StringValue(opts.Key), aws.StringValue(opts.VersionId))
+}
+
+// SharedCache - couchbase backed shared report cache (the documents expire with the cache ttl)
+type SharedCache struct {
+	con    *Connectors
+	bucket string
+}
+
+// NewSharedCache - returns the shared cache backend on the couchbase bucket
+func NewSharedCache(con *Connectors, bucket string) *SharedCache {
+	return &SharedCache{con: con, bucket: bucket}
+}
+
+// Get - a missing document (or any error) is a miss
+func (s *SharedCache) Get(key string) (*schema.ReportContent, bool) {
+	var rc *schema.ReportContent
+	res, err := s.con.Cluster.Bucket(s.bucket).DefaultCollection().Get(SHAREDCACHEPREFIX+key, &gocb.GetOptions{})
+	if err != nil {
+		if !errors.Is(err, gocb.ErrDocumentNotFound) {
+			s.con.Error("Function SharedCache (get) %v", err)
+		}
+		return nil, false
+	}
+	err = res.Content(&rc)
+	if err != nil {
+		s.con.Error("Function SharedCache (content) %v", err)
+		return nil, false
+	}
+	return rc, true
+}
+
+// Set - upserts the report with the ttl as the document expiry
+func (s *SharedCache) Set(key string, rc *schema.ReportContent, ttl time.Duration) {
+	_, err := s.con.Cluster.Bucket(s.bucket).DefaultCollection().Upsert(SHAREDCACHEPREFIX+key, rc, &gocb.UpsertOptions{Expiry: ttl})
+	if err != nil {
+		s.con.Error("Function SharedCache (upsert) %v", err)
+	}
+}
+
+// Delete - removes the report (a missing document is not an error)
+func (s *SharedCache) Delete(key string) {
+	_, err := s.con.Cluster.Bucket(s.bucket).DefaultCollection().Remove(SHAREDCACHEPREFIX+key, &gocb.RemoveOptions{})
+	if err != nil && !errors.Is(err, gocb.ErrDocumentNotFound) {
+		s.con.Error("Function SharedCache (remove) %v", err)
+	}
+}
+
+// GetRawObject - S3 Object download wrapper (returns the decompressed object as is i.e the raw mime email)
+func (c *Connectors) GetRawObject(opts *s3.GetObjectInput) ([]byte, error) {
+	_, call := startCall(c.ctx, "s3", "GetRawObject", s3Attributes(opts.Bucket, opts.Key)...)
+	result, err := c.S3Service.GetObject(opts)
+	defer call.end(&err)
+	if err != nil {
+		c.Error("Function GetRawObject %v", err)
+		return nil, err
+	}
+
+	b, err := readObject(result, maxObjectSize())
+	if err != nil {
+		c.Error("Function GetRawObject %s %v", aws.StringValue(opts.Key), err)
+		return nil, err
+	}
+	return b, nil
+}
+
+// PutObject - S3 Object upload wrapper (a put is atomic, set ContentMD5 so a corrupted upload is rejected)
+// the cached copy of the object (if any) is invalidated
+func (c *Connectors) PutObject(opts *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	_, call := startCall(c.ctx, "s3", "PutObject", s3Attributes(opts.Bucket, opts.Key)...)
+	out, err := c.S3Service.PutObject(opts)
+	defer call.end(&err)
+	if err != nil {
+		c.Error("Function PutObject %s %v", aws.StringValue(opts.Key), err)
+		return out, err
+	}
+	c.InvalidateObject(&s3.GetObjectInput{Bucket: opts.Bucket, Key: opts.Key})
+	return out, nil
+}
+
+// ListObjects - S3 list wrapper (a single page, use the ContinuationToken for the next page)
+func (c *Connectors) ListObjects(opts *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	_, call := startCall(c.ctx, "s3", "ListObjects", semconv.AWSS3Bucket(aws.StringValue(opts.Bucket)), attribute.String("aws.s3.prefix", aws.StringValue(opts.Prefix)))
+	out, err := c.S3Service.ListObjectsV2(opts)
+	defer call.end(&err)
+	if err != nil {
+		c.Error("Function ListObjects %v", err)
+		return out, err
+	}
+	return out, nil
+}
+
+// HeadObject - S3 object metadata wrapper (nothing is downloaded, a missing object returns the NotFound code)
+func (c *Connectors) HeadObject(opts *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	_, call := startCall(c.ctx, "s3", "HeadObject", s3Attributes(opts.Bucket, opts.Key)...)
+	out, err := c.S3Service.HeadObject(opts)
+	defer call.end(&err)
+	if err != nil {
+		c.Error("Function HeadObject %v", err)
+		return out, err
+	}
+	return out, nil
+}
+
+// ListObjectVersions - S3 version list wrapper (a single page, use the KeyMarker and VersionIdMarker for the next page)
+func (c *Connectors) ListObjectVersions(opts *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	_, call := startCall(c.ctx, "s3", "ListObjectVersions", semconv.AWSS3Bucket(aws.StringValue(opts.Bucket)), attribute.String("aws.s3.prefix", aws.StringValue(opts.Prefix)))
+	out, err := c.S3Service.ListObjectVersions(opts)
+	defer call.end(&err)
+	if err != nil {
+		c.Error("Function ListObjectVersions %v", err)
+		return out, err
+	}
+	return out, nil
+}
+
+// PresignGetObject - returns a short lived presigned GET url for the object (nothing is downloaded)
+func (c *Connectors) PresignGetObject(opts *s3.GetObjectInput, expiry time.Duration) (string, error) {
+	_, call := startCall(c.ctx, "s3", "PresignGetObject", s3Attributes(opts.Bucket, opts.Key)...)
+	req, _ := c.S3Service.GetObjectRequest(opts)
+	url, err := req.Presign(expiry)
+	defer call.end(&err)
+	if err != nil {
+		c.Error("Function PresignGetObject %v", err)
+		return "", err
+	}
+	return url, nil
+}
+
 // Upsert : wrapper function for couchbase update
 func (c *Connectors) Upsert(uuid string, value interface{}, opts *gocb.UpsertOptions) (*gocb.MutationResult, error) {
 	collection := c.Bucket.DefaultCollection()
-	return collection.Upsert(uuid, value, opts)
+	_, call := startCall(c.ctx, "couchbase", "Upsert", couchbaseAttributes("upsert", uuid)...)
+	res, err := collection.Upsert(uuid, value, opts)
+	call.end(&err)
+	return res, err
+}
+
+// Replace : wrapper function for couchbase replace (honours the cas set in the options)
+func (c *Connectors) Replace(uuid string, value interface{}, opts *gocb.ReplaceOptions) (*gocb.MutationResult, error) {
+	collection := c.Bucket.DefaultCollection()
+	_, call := startCall(c.ctx, "couchbase", "Replace", couchbaseAttributes("replace", uuid)...)
+	res, err := collection.Replace(uuid, value, opts)
+	call.end(&err)
+	return res, err
+}
+
+// Insert : wrapper function for couchbase insert (fails if the document exists) on the given bucket
+func (c *Connectors) Insert(bucket string, uuid string, value interface{}, opts *gocb.InsertOptions) (*gocb.MutationResult, error) {
+	collection := c.Cluster.Bucket(bucket).DefaultCollection()
+	_, call := startCall(c.ctx, "couchbase", "Insert", couchbaseAttributes("insert", uuid)...)
+	res, err := collection.Insert(uuid, value, opts)
+	call.end(&err)
+	return res, err
+}
+
+// Remove : wrapper function for couchbase remove
+func (c *Connectors) Remove(uuid string, opts *gocb.RemoveOptions) (*gocb.MutationResult, error) {
+	collection := c.Bucket.DefaultCollection()
+	_, call := startCall(c.ctx, "couchbase", "Remove", couchbaseAttributes("remove", uuid)...)
+	res, err := collection.Remove(uuid, opts)
+	call.end(&err)
+	return res, err
+}
+
+// MutateIn : wrapper function for couchbase sub-document mutations
+func (c *Connectors) MutateIn(uuid string, specs []gocb.MutateInSpec, opts *gocb.MutateInOptions) (*gocb.MutateInResult, error) {
+	collection := c.Bucket.DefaultCollection()
+	_, call := startCall(c.ctx, "couchbase", "MutateIn", couchbaseAttributes("mutate_in", uuid)...)
+	res, err := collection.MutateIn(uuid, specs, opts)
+	call.end(&err)
+	return res, err
+}
+
+// GetReport - get a single report (with its cas version token) from couchbase
+func (c *Connectors) GetReport(id string) (*schema.ReportList, error) {
+	var stats schema.ListObject
+	collection := c.Bucket.DefaultCollection()
+	_, call := startCall(c.ctx, "couchbase", "Get", couchbaseAttributes("get", id)...)
+	res, err := collection.Get(id, &gocb.GetOptions{})
+	defer call.end(&err)
+	if err != nil {
+		c.Error("Function GetReport %v", err)
+		return nil, err
+	}
+	err = res.Content(&stats)
+	if err != nil {
+		c.Error("Function GetReport %v", err)
+		return nil, err
+	}
+	c.Trace("Function GetReport id %s cas %v", id, res.Cas())
+	return &schema.ReportList{Id: id, Cas: schema.Cas(res.Cas()), ServisbotStats: stats}, nil
 }
 
 // GetList - get all reports list
@@ -72,9 +367,11 @@ func (c *Connectors) GetList(offset string, limit string) ([]schema.ReportList,
 	var stats []schema.ReportList
 	var stat *schema.ReportList
 
-	query := "select meta().id as id,* from servisbotstats order by `servisbotstats`.`Timestamp` desc offset " + offset + " limit " + limit
+	query := "select meta().id as id,meta().cas as cas,* from servisbotstats order by `servisbotstats`.`Timestamp` desc offset " + offset + " limit " + limit
 	c.Trace("Function GetList %s", query)
+	_, call := startCall(c.ctx, "n1ql", "GetList", queryAttributes("GetList", query)...)
 	res, err := c.Cluster.Query(query, &gocb.QueryOptions{})
+	defer call.end(&err)
 	if err != nil {
 		return stats, err
 	}
@@ -96,12 +393,113 @@ func (c *Connectors) GetList(offset string, limit string) ([]schema.ReportList,
 	return stats, nil
 }
 
+// GetAuditList - get the audit history filtered by field (ReportId or User) most recent first
+func (c *Connectors) GetAuditList(field string, value string, offset string, limit string) ([]schema.AuditRecord, error) {
+	var records []schema.AuditRecord
+	var record *schema.AuditRecord
+
+	query := "select meta().id as id,`servisbotaudit`.* from servisbotaudit where `" + field + "` = $1 order by `Timestamp` desc offset " + offset + " limit " + limit
+	c.Trace("Function GetAuditList %s", query)
+	_, call := startCall(c.ctx, "n1ql", "GetAuditList", queryAttributes("GetAuditList", query)...)
+	res, err := c.Cluster.Query(query, &gocb.QueryOptions{PositionalParameters: []interface{}{value}})
+	defer call.end(&err)
+	if err != nil {
+		return records, err
+	}
+	defer res.Close()
+
+	// iterate through each object, a record that can't be decoded fails the page (it is not silently cut short)
+	for res.Next() {
+		err = res.Row(&record)
+		if err != nil {
+			c.Error("Function GetAuditList (row) %v", err)
+			return records, err
+		}
+		records = append(records, *record)
+	}
+
+	// always check for errors after iterating
+	err = res.Err()
+	if err != nil {
+		return records, err
+	}
+	return records, nil
+}
+
+// GetIds - returns every document id in servisbotstats (used for reconciliation)
+func (c *Connectors) GetIds() ([]string, error) {
+	var ids []string
+	var id string
+
+	query := "select raw meta().id from servisbotstats"
+	c.Trace("Function GetIds %s", query)
+	_, call := startCall(c.ctx, "n1ql", "GetIds", queryAttributes("GetIds", query)...)
+	res, err := c.Cluster.Query(query, &gocb.QueryOptions{})
+	defer call.end(&err)
+	if err != nil {
+		return ids, err
+	}
+
+	// iterate through each object
+	for res.Next() {
+		err := res.Row(&id)
+		if err != nil {
+			return ids, err
+		}
+		ids = append(ids, id)
+	}
+
+	// always check for errors after iterating
+	err = res.Err()
+	if err != nil {
+		return ids, err
+	}
+	return ids, nil
+}
+
+// GetExisting - returns the ids (of the given ids) that have a document in servisbotstats (a single keyed lookup)
+func (c *Connectors) GetExisting(ids []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	var id string
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	query := "select raw meta().id from servisbotstats use keys $ids"
+	c.Trace("Function GetExisting %s (%d ids)", query, len(ids))
+	_, call := startCall(c.ctx, "n1ql", "GetExisting", queryAttributes("GetExisting", query)...)
+	res, err := c.Cluster.Query(query, &gocb.QueryOptions{NamedParameters: map[string]interface{}{"ids": ids}})
+	defer call.end(&err)
+	if err != nil {
+		c.Error("Function GetExisting %v", err)
+		return existing, err
+	}
+
+	// iterate through each object
+	for res.Next() {
+		err := res.Row(&id)
+		if err != nil {
+			return existing, err
+		}
+		existing[id] = true
+	}
+
+	// always check for errors after iterating
+	err = res.Err()
+	if err != nil {
+		return existing, err
+	}
+	return existing, nil
+}
+
 // GetListCount - get total of reports in related to s3 report bucket from couchbase
 func (c *Connectors) GetListCount() (*int64, error) {
 	var count map[string]int64
 	query := "select count(meta().id) as count from servisbotstats"
 	c.Trace("Function GetListCount %s", query)
+	_, call := startCall(c.ctx, "n1ql", "GetListCount", queryAttributes("GetListCount", query)...)
 	res, err := c.Cluster.Query(query, &gocb.QueryOptions{})
+	defer call.end(&err)
 	if err != nil {
 		v := int64(0)
 		return &v, err
@@ -124,55 +522,61 @@ func (c *Connectors) GetListCount() (*int64, error) {
 	return &v, nil
 }
 
-// GetConfusiorMatrix - get confusion matrix stats for bot accuracy
-func (c *Connectors) GetConfusionMatrix() (*schema.ConfusionMatrix, error) {
-	var cm = &schema.ConfusionMatrix{}
-
-	// we first get all the counts for the bot
-	query := "select distinct ProcessOutcome,'UserClassification' as UserCalssififcation,count(ProcessOutcome) as count from servisbotstats where  UserClassification != \"\" group by ProcessOutcome"
-	statsTotal, err := getStatsData(query, c)
-	if err != nil {
-		return cm, err
-	}
-
-	query = "select count(ProcessOutcome) as count,ProcessOutcome,UserClassification from servisbotstats where ProcessOutcome == \"No Action\" and UserClassification != \"No Action\" group by ProcessOutcome,UserClassification"
-	statsA, err := getStatsData(query, c)
+// GetUnreviewedCount - get the number of reports that have not been classified by a reviewer (the review backlog)
+func (c *Connectors) GetUnreviewedCount() (*int64, error) {
+	var count map[string]int64
+	v := int64(0)
+	query := "select count(meta().id) as count from servisbotstats where UserClassification is missing or UserClassification = \"\""
+	c.Trace("Function GetUnreviewedCount %s", query)
+	_, call := startCall(c.ctx, "n1ql", "GetUnreviewedCount", queryAttributes("GetUnreviewedCount", query)...)
+	res, err := c.Cluster.Query(query, &gocb.QueryOptions{})
+	defer call.end(&err)
 	if err != nil {
-		return cm, err
+		c.Error("Function GetUnreviewedCount %v", err)
+		return &v, err
 	}
-
-	// now get all no actions
-	query = "select count(ProcessOutcome) as count,ProcessOutcome,UserClassification from servisbotstats where ProcessOutcome == \"Cancel Subscription\" and UserClassification != \"Cancel Subscription\" group by ProcessOutcome,UserClassification"
-	statsB, err := getStatsData(query, c)
+	err = res.One(&count)
 	if err != nil {
-		return cm, err
+		c.Error("Function GetUnreviewedCount %v", err)
+		return &v, err
 	}
+	v = count["count"]
+	return &v, nil
+}
 
-	// now get all no actions
-	query = "select count(ProcessOutcome) as count,ProcessOutcome,UserClassification from servisbotstats where ProcessOutcome == \"Cancel Autorenewal\" and UserClassification != \"Cancel Autorenewal\" group by ProcessOutcome,UserClassification"
-	statsC, err := getStatsData(query, c)
+// GetConfusiorMatrix - get confusion matrix stats for bot accuracy
+func (c *Connectors) GetConfusionMatrix() (*schema.ConfusionMatrix, error) {
+	var cm = &schema.ConfusionMatrix{}
+	var err error
+	ctx, call := startCall(c.ctx, "couchbase", "GetConfusionMatrix")
+	defer call.end(&err)
+
+	// get all the reviewed counts grouped by outcome and classification
+	// labels are normalized (per affiliate) with the taxonomy before being added to the 3X3 matrix
+	// so aliases (i.e "Cancel") are no longer dropped from the stats
+	query := "select AffiliateId,ProcessOutcome,UserClassification,count(ProcessOutcome) as count from servisbotstats where UserClassification != \"\" group by AffiliateId,ProcessOutcome,UserClassification"
+	stats, err := getStatsData(ctx, query, c)
 	if err != nil {
 		return cm, err
 	}
 
-	// we now have all te relevant values for the 3X3 matrix
-	// let build our return matrix
-	// we know that the statsA array is for NoAction
-	cm = updateStatsStruct(statsA, statsB, statsC, statsTotal)
-
+	cm = updateStatsStruct(stats, taxonomy.Get())
 	return cm, nil
 }
 
-func getStatsData(query string, c *Connectors) ([]schema.Stat, error) {
+// getStatsData - private function, runs the stats query (the query span is a child of the caller's span)
+func getStatsData(ctx context.Context, query string, c *Connectors) ([]schema.Stat, error) {
 	var stats []schema.Stat
 	var stat *schema.Stat
 	c.Info("Function getStatsData %s", query)
+	_, call := startCall(ctx, "n1ql", "getStatsData", queryAttributes("getStatsData", query)...)
 	res, err := c.Cluster.Query(query, &gocb.QueryOptions{})
-	defer res.Close()
+	defer call.end(&err)
 	if err != nil {
 		c.Error("Function getStatsData (query) %v", err)
 		return stats, err
 	}
+	defer res.Close()
 
 	// iterate through each object
 	// struct with int64,string,string
@@ -195,55 +599,34 @@ func getStatsData(query string, c *Connectors) ([]schema.Stat, error) {
 	return stats, nil
 }
 
-func updateStatsStruct(in ...[]schema.Stat) *schema.ConfusionMatrix {
-
+// updateStatsStruct - private function, builds the 3X3 matrix (rows are the bot outcome, columns the user classification)
+// the labels are counted as their taxonomy class (every label of a valid taxonomy has one)
+func updateStatsStruct(stats []schema.Stat, t *taxonomy.Taxonomy) *schema.ConfusionMatrix {
 	var cm = &schema.ConfusionMatrix{}
 
-	for _, item := range in[0] {
-		switch item.UserClassification {
-		case "Cancel Subscription":
-			cm.NoAction.Cancel = item.Count
-			break
-		case "Cancel Autorenewal":
-			cm.NoAction.CancelAR = item.Count
-			break
-		}
-	}
-
-	for _, item := range in[1] {
-		switch item.UserClassification {
-		case "No Action":
-			cm.Cancel.NoAction = item.Count
-			break
-		case "Cancel Autorenewal":
-			cm.Cancel.CancelAR = item.Count
-			break
-		}
-	}
-
-	for _, item := range in[2] {
-		switch item.UserClassification {
-		case "No Action":
-			cm.CancelAR.NoAction = item.Count
-			break
-		case "Cancel Subscription":
-			cm.CancelAR.Cancel = item.Count
-			break
+	for _, item := range stats {
+		outcome := t.Class(item.AffiliateId, item.ProcessOutcome)
+		classification := t.Class(item.AffiliateId, item.UserClassification)
+		switch outcome {
+		case taxonomy.NOACTION:
+			addStat(&cm.NoAction.NoAction, &cm.NoAction.Cancel, &cm.NoAction.CancelAR, classification, item.Count)
+		case taxonomy.CANCEL:
+			addStat(&cm.Cancel.NoAction, &cm.Cancel.Cancel, &cm.Cancel.CancelAR, classification, item.Count)
+		case taxonomy.CANCELAR:
+			addStat(&cm.CancelAR.NoAction, &cm.CancelAR.Cancel, &cm.CancelAR.CancelAR, classification, item.Count)
 		}
 	}
+	return cm
+}
 
-	for _, item := range in[3] {
-		switch item.ProcessOutcome {
-		case "No Action":
-			cm.NoAction.NoAction = item.Count - (cm.NoAction.Cancel + cm.NoAction.CancelAR)
-			break
-		case "Cancel Subscription":
-			cm.Cancel.Cancel = item.Count - (cm.Cancel.NoAction + cm.Cancel.CancelAR)
-			break
-		case "Cancel Autorenewal":
-			cm.CancelAR.CancelAR = item.Count - (cm.CancelAR.NoAction + cm.CancelAR.Cancel)
-			break
-		}
+// addStat - private function, adds the count to the matching column of a matrix row
+func addStat(noAction *int64, cancel *int64, cancelAR *int64, classification string, count int64) {
+	switch classification {
+	case taxonomy.NOACTION:
+		*noAction += count
+	case taxonomy.CANCEL:
+		*cancel += count
+	case taxonomy.CANCELAR:
+		*cancelAR += count
 	}
-	return cm
 }
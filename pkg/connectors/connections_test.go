@@ -3,18 +3,31 @@
 package connectors
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/cache"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
 	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/taxonomy"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 	gocb "github.com/couchbase/gocb/v2"
-	"github.com/microlib/simple"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestConnections(t *testing.T) {
 
-	var logger = &simple.Logger{Level: "trace"}
+	var logger = &logging.Logger{Level: "trace"}
 
 	t.Run("Logging : should pass", func(t *testing.T) {
 		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
@@ -24,6 +37,35 @@ func TestConnections(t *testing.T) {
 		con.Error("Log Error")
 	})
 
+	t.Run("WithContext : should pass (request id on every line)", func(t *testing.T) {
+		var buf bytes.Buffer
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: &logging.Logger{Level: "trace", Out: &buf}}
+		if con.WithContext(context.Background()) != con {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (no request id is the same connectors) -  got (%v) wanted (%v)", "WithContext", false, true))
+		}
+		con.WithContext(logging.WithRequestID(context.Background(), "abc-123")).Error("Log Error")
+		con.Info("Log Info")
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 || !strings.Contains(lines[0], `"requestId":"abc-123"`) || strings.Contains(lines[1], "requestId") {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (request id on the bound connectors only) -  got (%v) wanted (%s)", "WithContext", lines, "abc-123"))
+		}
+	})
+
+	t.Run("TraceBody : should pass (jwt masked, nothing at info level)", func(t *testing.T) {
+		var buf bytes.Buffer
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: &logging.Logger{Level: "trace", Out: &buf}}
+		con.TraceBody("request body : %s", []byte(`{"jwtToken": "eyJhbGciOiJIUzI1NiJ9.e30.sig", "data": {"id": "test"}}`))
+		if strings.Contains(buf.String(), "eyJhbGciOiJIUzI1NiJ9") || !strings.Contains(buf.String(), `\"id\":\"test\"`) {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (jwt is masked) -  got (%s) wanted (%s)", "TraceBody", buf.String(), "****"))
+		}
+		buf.Reset()
+		con.Logger.Level = "info"
+		con.TraceBody("request body : %s", []byte(`{}`))
+		if buf.Len() != 0 {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (nothing logged at info) -  got (%s) wanted (%s)", "TraceBody", buf.String(), ""))
+		}
+	})
+
 	t.Run("GetObject : should pass", func(t *testing.T) {
 		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
 		bucket := "Email/"
@@ -60,6 +102,260 @@ func TestConnections(t *testing.T) {
 		con.Info("Data result %v", err)
 	})
 
+	t.Run("GetObject : should pass (gzip and zstd objects)", func(t *testing.T) {
+		for _, force := range []string{"gzip", "zstd"} {
+			con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{Force: force}, Logger: logger}
+			bucket := "Email/"
+			key := "12345"
+			data, err := con.GetObject(&s3.GetObjectInput{Bucket: &bucket, Key: &key})
+			if err != nil || data.EmailAdress == "" {
+				t.Errorf(fmt.Sprintf("Function (%s) assert (%s object is decompressed) -  got (%v %v) wanted (%v)", "GetObject", force, data, err, nil))
+			}
+			raw, err := con.GetRawObject(&s3.GetObjectInput{Bucket: &bucket, Key: &key})
+			if err != nil || !strings.HasPrefix(strings.TrimSpace(string(raw)), "{") {
+				t.Errorf(fmt.Sprintf("Function (%s) assert (%s object is decompressed) -  got (%v) wanted (%v)", "GetRawObject", force, err, nil))
+			}
+		}
+	})
+
+	t.Run("GetObject : should fail (corrupt gzip object)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{Force: "corrupt"}, Logger: logger}
+		bucket := "Email/"
+		key := "12345"
+		_, err := con.GetObject(&s3.GetObjectInput{Bucket: &bucket, Key: &key})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "GetObject", nil, "error"))
+		}
+	})
+
+	t.Run("GetObject : should fail (decompressed size guard)", func(t *testing.T) {
+		os.Setenv(MAXOBJECTSIZE, "64")
+		defer os.Unsetenv(MAXOBJECTSIZE)
+		for _, force := range []string{"", "gzip", "zstd"} {
+			con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{Force: force}, Logger: logger}
+			bucket := "Email/"
+			key := "12345"
+			_, err := con.GetObject(&s3.GetObjectInput{Bucket: &bucket, Key: &key})
+			if !errors.Is(err, ErrObjectTooLarge) {
+				t.Errorf(fmt.Sprintf("Function (%s) assert (%q object is too large) -  got (%v) wanted (%v)", "GetObject", force, err, ErrObjectTooLarge))
+			}
+		}
+	})
+
+	t.Run("GetObject : should pass (served from the cache)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger, Cache: cache.New(10, 0, time.Minute)}
+		bucket := "Email/"
+		key := "12345"
+		opts := &s3.GetObjectInput{Bucket: &bucket, Key: &key}
+		_, err := con.GetObject(opts)
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v) wanted (%v)", "GetObject", err, nil))
+		}
+		// s3 errors are not seen once the object is cached
+		con.S3Service.Force = "true"
+		_, err = con.GetObject(opts)
+		if err != nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (cache hit) -  got (%v) wanted (%v)", "GetObject", err, nil))
+		}
+		con.InvalidateObject(opts)
+		_, err = con.GetObject(opts)
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (invalidated entry is downloaded) -  got (%v) wanted (%s)", "GetObject", err, "error"))
+		}
+	})
+
+	t.Run("SharedCache : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		shared := NewSharedCache(con, "reportcache")
+		shared.Set("bucket/Email/12345", &schema.ReportContent{}, time.Minute)
+		rc, ok := shared.Get("bucket/Email/12345")
+		if !ok || rc.ProcessOutcome != "No Action" {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (hit) -  got (%v %v) wanted (%s)", "SharedCache", rc, ok, "No Action"))
+		}
+		shared.Delete("bucket/Email/12345")
+	})
+
+	t.Run("SharedCache : should fail (forced errors are a miss)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{Force: "error"}, S3Service: &FakeS3{}, Logger: logger}
+		shared := NewSharedCache(con, "reportcache")
+		shared.Set("bucket/Email/12345", &schema.ReportContent{}, time.Minute)
+		if _, ok := shared.Get("bucket/Email/12345"); ok {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (miss) -  got (%v) wanted (%v)", "SharedCache", ok, false))
+		}
+		shared.Delete("bucket/Email/12345")
+	})
+
+	t.Run("GetRawObject : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		bucket := "Email/"
+		key := "7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1"
+		opts := &s3.GetObjectInput{Bucket: &bucket, Key: &key}
+		data, err := con.GetRawObject(opts)
+		if err != nil || len(data) == 0 {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v) wanted (%v)", "GetRawObject", err, nil))
+		}
+	})
+
+	t.Run("GetRawObject : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{Force: "true"}, Logger: logger}
+		bucket := "Email/"
+		key := "7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1"
+		opts := &s3.GetObjectInput{Bucket: &bucket, Key: &key}
+		_, err := con.GetRawObject(opts)
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "GetRawObject", nil, "error"))
+		}
+	})
+
+	t.Run("PresignGetObject : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		bucket := "servisbot"
+		key := "Email/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1"
+		url, err := con.PresignGetObject(&s3.GetObjectInput{Bucket: &bucket, Key: &key}, 5*time.Minute)
+		if err != nil || !strings.Contains(url, "X-Amz-Expires=300") {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v %s) wanted (%v)", "PresignGetObject", err, url, nil))
+		}
+	})
+
+	t.Run("PresignGetObject : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{Force: "true"}, Logger: logger}
+		bucket := "servisbot"
+		key := "Email/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1"
+		_, err := con.PresignGetObject(&s3.GetObjectInput{Bucket: &bucket, Key: &key}, 5*time.Minute)
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "PresignGetObject", nil, "error"))
+		}
+	})
+
+	t.Run("ListObjects : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		bucket, prefix := "servisbot", "Email/"
+		out, err := con.ListObjects(&s3.ListObjectsV2Input{Bucket: &bucket, Prefix: &prefix})
+		if err != nil || len(out.Contents) != 1 || !*out.IsTruncated {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v) wanted (%v)", "ListObjects", err, nil))
+		}
+	})
+
+	t.Run("ListObjects : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{Force: "true"}, Logger: logger}
+		bucket, prefix := "servisbot", "Email/"
+		_, err := con.ListObjects(&s3.ListObjectsV2Input{Bucket: &bucket, Prefix: &prefix})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "ListObjects", nil, "error"))
+		}
+	})
+
+	t.Run("HeadObject : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		bucket, key := "servisbot", "Email/12345"
+		out, err := con.HeadObject(&s3.HeadObjectInput{Bucket: &bucket, Key: &key})
+		if err != nil || *out.ContentLength != 1024 {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v) wanted (%v)", "HeadObject", err, nil))
+		}
+	})
+
+	t.Run("HeadObject : should fail (not found)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		bucket, key := "servisbot", "Email/missing"
+		_, err := con.HeadObject(&s3.HeadObjectInput{Bucket: &bucket, Key: &key})
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != "NotFound" {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be not found) -  got (%v) wanted (%v)", "HeadObject", err, "NotFound"))
+		}
+	})
+
+	t.Run("ListObjectVersions : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		bucket := "bucket"
+		prefix := "Email/12345"
+		out, err := con.ListObjectVersions(&s3.ListObjectVersionsInput{Bucket: &bucket, Prefix: &prefix})
+		if err != nil || len(out.Versions) != 2 {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (two versions) -  got (%v %v) wanted (%d)", "ListObjectVersions", out, err, 2))
+		}
+	})
+
+	t.Run("ListObjectVersions : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{Force: "true"}, Logger: logger}
+		bucket := "bucket"
+		prefix := "Email/12345"
+		_, err := con.ListObjectVersions(&s3.ListObjectVersionsInput{Bucket: &bucket, Prefix: &prefix})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "ListObjectVersions", nil, "error"))
+		}
+	})
+
+	t.Run("PutObject : should pass (cached copy is invalidated)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger, Cache: cache.New(10, 0, time.Minute)}
+		bucket := "reports"
+		key := "Email/12345"
+		con.Cache.Put(cache.Key(bucket, key, ""), &schema.ReportContent{}, 1)
+		out, err := con.PutObject(&s3.PutObjectInput{Bucket: &bucket, Key: &key, Body: strings.NewReader("{}")})
+		if err != nil || *out.VersionId != "v3" || con.Cache.Len() != 0 {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v %v %d) wanted (%v %s %d)", "PutObject", out, err, con.Cache.Len(), nil, "v3", 0))
+		}
+	})
+
+	t.Run("PutObject : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{Force: "put"}, Logger: logger}
+		bucket := "reports"
+		key := "Email/12345"
+		_, err := con.PutObject(&s3.PutObjectInput{Bucket: &bucket, Key: &key, Body: strings.NewReader("{}")})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "PutObject", nil, "error"))
+		}
+	})
+
+	t.Run("GetIds : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		ids, err := con.GetIds()
+		if err != nil || len(ids) != 3 {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v %v) wanted (%v)", "GetIds", err, ids, nil))
+		}
+	})
+
+	t.Run("GetIds : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{Force: "true"}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.GetIds()
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "GetIds", nil, "error"))
+		}
+	})
+
+	t.Run("GetExisting : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		existing, err := con.GetExisting([]string{"report-1.json", "report-9.json"})
+		if err != nil || !existing["report-1.json"] || existing["report-9.json"] {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v %v) wanted (%v)", "GetExisting", err, existing, nil))
+		}
+		existing, err = con.GetExisting([]string{})
+		if err != nil || len(existing) != 0 {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (no ids no query) -  got (%v %v) wanted (%d)", "GetExisting", err, existing, 0))
+		}
+	})
+
+	t.Run("GetExisting : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{Force: "true"}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.GetExisting([]string{"report-1.json"})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "GetExisting", nil, "error"))
+		}
+	})
+
+	t.Run("Remove : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.Remove("123456", &gocb.RemoveOptions{})
+		if err != nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v) wanted (%v)", "Remove", err, nil))
+		}
+	})
+
+	t.Run("Remove : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{Force: "error"}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.Remove("123456", &gocb.RemoveOptions{})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "Remove", nil, "error"))
+		}
+	})
+
 	t.Run("Upsert : should pass", func(t *testing.T) {
 		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
 		data, err := con.Upsert("123456", &schema.ReportContent{}, &gocb.UpsertOptions{})
@@ -78,6 +374,107 @@ func TestConnections(t *testing.T) {
 		con.Info("Data result %v", err)
 	})
 
+	t.Run("Replace : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		data, err := con.Replace("123456", &schema.ListObject{}, &gocb.ReplaceOptions{Cas: gocb.Cas(1612345678901234)})
+		if err != nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v) wanted (%v)", "Replace", err, nil))
+		}
+		con.Info("Data result %v", data)
+	})
+
+	t.Run("Replace : should fail (forced cas mismatch)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{Force: "cas"}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.Replace("123456", &schema.ListObject{}, &gocb.ReplaceOptions{Cas: gocb.Cas(1612345678901234)})
+		if !errors.Is(err, gocb.ErrCasMismatch) {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be cas mismatch) -  got (%v) wanted (%v)", "Replace", err, gocb.ErrCasMismatch))
+		}
+		con.Info("Data result %v", err)
+	})
+
+	t.Run("MutateIn : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		specs := []gocb.MutateInSpec{gocb.UpsertSpec("UserClassification", "No Action", &gocb.UpsertSpecOptions{})}
+		data, err := con.MutateIn("123456", specs, &gocb.MutateInOptions{Cas: gocb.Cas(1612345678901234)})
+		if err != nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v) wanted (%v)", "MutateIn", err, nil))
+		}
+		con.Info("Data result %v", data)
+	})
+
+	t.Run("MutateIn : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{Force: "error"}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		specs := []gocb.MutateInSpec{gocb.UpsertSpec("UserClassification", "No Action", &gocb.UpsertSpecOptions{})}
+		_, err := con.MutateIn("123456", specs, &gocb.MutateInOptions{Cas: gocb.Cas(1612345678901234)})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "MutateIn", nil, "error"))
+		}
+		con.Info("Data result %v", err)
+	})
+
+	t.Run("UpdateReports : should pass", func(t *testing.T) {
+		var updated []string
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		err := con.UpdateReports([]string{"r1", "r2"}, func(id string, current *schema.ListObject) error {
+			current.UserClassification = "No Action"
+			updated = append(updated, id)
+			return nil
+		})
+		if err != nil || len(updated) != 2 {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (every document should be updated) -  got (%v %v) wanted (%v %v)", "UpdateReports", err, updated, nil, []string{"r1", "r2"}))
+		}
+	})
+
+	t.Run("UpdateReports : should fail (update error aborts)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		err := con.UpdateReports([]string{"r1", "r2"}, func(id string, current *schema.ListObject) error {
+			return gocb.ErrCasMismatch
+		})
+		if !errors.Is(err, gocb.ErrCasMismatch) {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be cas mismatch) -  got (%v) wanted (%v)", "UpdateReports", err, gocb.ErrCasMismatch))
+		}
+	})
+
+	t.Run("UpdateReports : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{Force: "error"}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		err := con.UpdateReports([]string{"r1"}, func(id string, current *schema.ListObject) error {
+			return nil
+		})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "UpdateReports", nil, "error"))
+		}
+	})
+
+	t.Run("GetReport : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		data, err := con.GetReport("123456")
+		if err != nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v) wanted (%v)", "GetReport", err, nil))
+		}
+		if data == nil || data.Cas == 0 {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (cas should be set) -  got (%v) wanted (%s)", "GetReport", data, "cas"))
+		}
+		con.Info("Data result %v", data)
+	})
+
+	t.Run("GetReport : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{Force: "error"}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.GetReport("123456")
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "GetReport", nil, "error"))
+		}
+		con.Info("Data result %v", err)
+	})
+
+	t.Run("GetReport : should fail (forced content error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{Force: "content"}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.GetReport("123456")
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "GetReport", nil, "error"))
+		}
+		con.Info("Data result %v", err)
+	})
+
 	t.Run("GetList : should pass", func(t *testing.T) {
 		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
 		data, err := con.GetList("0", "10")
@@ -96,6 +493,50 @@ func TestConnections(t *testing.T) {
 		con.Info("Data result %v", data)
 	})
 
+	t.Run("Insert : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		data, err := con.Insert("servisbotaudit", "audit::123456", &schema.AuditRecord{}, &gocb.InsertOptions{})
+		if err != nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v) wanted (%v)", "Insert", err, nil))
+		}
+		con.Info("Data result %v", data)
+	})
+
+	t.Run("Insert : should fail (forced document exists)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{Force: "exists"}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.Insert("servisbotaudit", "audit::123456", &schema.AuditRecord{}, &gocb.InsertOptions{})
+		if !errors.Is(err, gocb.ErrDocumentExists) {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be document exists) -  got (%v) wanted (%v)", "Insert", err, gocb.ErrDocumentExists))
+		}
+		con.Info("Data result %v", err)
+	})
+
+	t.Run("GetAuditList : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		data, err := con.GetAuditList("ReportId", "096esbpfrk8b3nhdlfhditsmk10gj03g06i3c201.json", "0", "10")
+		if err != nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v) wanted (%v)", "GetAuditList", err, nil))
+		}
+		con.Info("Data result %v", data)
+	})
+
+	t.Run("GetAuditList : should fail (record can't be decoded)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{Force: "row"}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.GetAuditList("User", "cduffy@tfd.ie", "0", "10")
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "GetAuditList", nil, "error"))
+		}
+	})
+
+	t.Run("GetAuditList : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{Force: "true"}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.GetAuditList("User", "cduffy@tfd.ie", "0", "10")
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "GetAuditList", nil, "error"))
+		}
+		con.Info("Data result %v", err)
+	})
+
 	t.Run("GetListCount : should pass", func(t *testing.T) {
 		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
 		data, err := con.GetListCount()
@@ -105,6 +546,22 @@ func TestConnections(t *testing.T) {
 		con.Info("Data result %v", data)
 	})
 
+	t.Run("GetUnreviewedCount : should pass", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
+		data, err := con.GetUnreviewedCount()
+		if err != nil || *data != 1234 {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v %v) wanted (%v)", "GetUnreviewedCount", err, *data, 1234))
+		}
+	})
+
+	t.Run("GetUnreviewedCount : should fail (forced error)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{Force: "true"}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.GetUnreviewedCount()
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "GetUnreviewedCount", nil, "error"))
+		}
+	})
+
 	t.Run("GetConfusionMatrix  : should pass", func(t *testing.T) {
 		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: logger}
 		data, err := con.GetConfusionMatrix()
@@ -114,4 +571,76 @@ func TestConnections(t *testing.T) {
 		con.Info("Data result %v", data)
 	})
 
+	t.Run("GetConfusionMatrix : should fail (query error, no result to close)", func(t *testing.T) {
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{Force: "true"}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.GetConfusionMatrix()
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (error should not be nil) -  got (%v) wanted (%v)", "GetConfusionMatrix", nil, "error"))
+		}
+	})
+
+	t.Run("GetConfusionMatrix : should pass (spans are children of the request span)", func(t *testing.T) {
+		rec := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+		defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+		var buf bytes.Buffer
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{}, S3Service: &FakeS3{}, Logger: &logging.Logger{Level: "trace", Out: &buf}}
+		ctx, request := otel.Tracer("test").Start(context.Background(), "request")
+		_, err := con.WithContext(ctx).GetConfusionMatrix()
+		request.End()
+		spans := rec.Ended()
+		if err != nil || len(spans) != 3 || spans[0].Name() != "n1ql.getStatsData" || spans[1].Name() != "couchbase.GetConfusionMatrix" {
+			t.Fatalf(fmt.Sprintf("Function (%s) assert (query and call spans) -  got (%v %v) wanted (%s)", "GetConfusionMatrix", err, spans, "n1ql.getStatsData couchbase.GetConfusionMatrix"))
+		}
+		if spans[0].Parent().SpanID() != spans[1].SpanContext().SpanID() || spans[1].Parent().SpanID() != request.SpanContext().SpanID() {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (query span in the call span in the request span) -  got (%v %v) wanted (%v)", "GetConfusionMatrix", spans[0].Parent(), spans[1].Parent(), request.SpanContext()))
+		}
+		if !strings.Contains(buf.String(), `"traceId":"`+request.SpanContext().TraceID().String()+`"`) {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (trace id on the log lines) -  got (%s) wanted (%s)", "WithContext", buf.String(), request.SpanContext().TraceID()))
+		}
+	})
+
+	t.Run("GetExisting : should fail (the query span records the error)", func(t *testing.T) {
+		rec := tracetest.NewSpanRecorder()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+		defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+		con := &Connectors{Bucket: &FakeBucket{}, Cluster: &FakeCluster{Force: "true"}, S3Service: &FakeS3{}, Logger: logger}
+		_, err := con.GetExisting([]string{"report-1.json"})
+		spans := rec.Ended()
+		if err == nil || len(spans) != 1 || spans[0].Name() != "n1ql.GetExisting" || spans[0].Status().Code != codes.Error {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (failed query span) -  got (%v %v) wanted (%s)", "GetExisting", err, spans, "n1ql.GetExisting error"))
+		}
+	})
+
+	t.Run("updateStatsStruct : should pass (affiliate label counted as its class)", func(t *testing.T) {
+		tx, err := taxonomy.Load("../../tests/label-taxonomy.json")
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Function (%s) assert (error should be nil) -  got (%v) wanted (%v)", "Load", err, nil))
+		}
+		stats := []schema.Stat{
+			{AffiliateId: "BH-01", ProcessOutcome: "Cancel Subscription", UserClassification: "Refund", Count: 4},
+			{AffiliateId: "BH-01", ProcessOutcome: "No Action", UserClassification: "refund", Count: 2},
+		}
+		cm := updateStatsStruct(stats, tx)
+		if cm.Cancel.Cancel != 4 || cm.NoAction.Cancel != 2 {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (matrix counts) -  got (%v) wanted (%s)", "updateStatsStruct", cm, "cancel.cancel 4, noaction.cancel 2"))
+		}
+	})
+
+	t.Run("updateStatsStruct : should pass (aliases normalized)", func(t *testing.T) {
+		stats := []schema.Stat{
+			{AffiliateId: "BH-01", ProcessOutcome: "No Action", UserClassification: "Cancel", Count: 5},
+			{AffiliateId: "BH-01", ProcessOutcome: "Cancel", UserClassification: "Cancel Subscription", Count: 7},
+			{AffiliateId: "BH-01", ProcessOutcome: "Cancel Subscription", UserClassification: "cancel", Count: 3},
+			{AffiliateId: "BH-01", ProcessOutcome: "Cancel Autorenewal", UserClassification: "No Action", Count: 2},
+			{AffiliateId: "BH-01", ProcessOutcome: "No Action", UserClassification: "Unknown", Count: 11},
+		}
+		cm := updateStatsStruct(stats, taxonomy.Default())
+		if cm.NoAction.Cancel != 5 || cm.Cancel.Cancel != 10 || cm.CancelAR.NoAction != 2 || cm.NoAction.NoAction != 0 {
+			t.Errorf(fmt.Sprintf("Function (%s) assert (matrix counts) -  got (%v) wanted (%s)", "updateStatsStruct", cm, "noaction.cancel 5, cancel.cancel 10, cancelar.noaction 2"))
+		}
+	})
+
 }
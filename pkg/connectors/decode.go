@@ -0,0 +1,78 @@
+package connectors
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	MAXOBJECTSIZE     string = "MAX_OBJECT_SIZE"
+	DEFAULTOBJECTSIZE int64  = 32 << 20
+)
+
+var (
+	// ErrObjectTooLarge - the (decompressed) object is larger than MAX_OBJECT_SIZE
+	ErrObjectTooLarge = errors.New("object exceeds the maximum size")
+	gzipMagic         = []byte{0x1f, 0x8b}
+	zstdMagic         = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// maxObjectSize - private function, the maximum (decompressed) object size from MAX_OBJECT_SIZE
+func maxObjectSize() int64 {
+	v, err := strconv.ParseInt(os.Getenv(MAXOBJECTSIZE), 10, 64)
+	if err != nil || v <= 0 {
+		return DEFAULTOBJECTSIZE
+	}
+	return v
+}
+
+// readObject - private function, reads (and closes) the object body
+// gzip and zstd objects are decompressed as a stream, detected by the Content-Encoding or the magic bytes
+// at most max bytes are read so that a small compressed object can't expand without limit
+func readObject(result *s3.GetObjectOutput, max int64) ([]byte, error) {
+	defer result.Body.Close()
+
+	br := bufio.NewReader(result.Body)
+	magic, _ := br.Peek(len(zstdMagic))
+	encoding := strings.ToLower(aws.StringValue(result.ContentEncoding))
+
+	var r io.Reader = br
+	switch {
+	case strings.Contains(encoding, "gzip") || bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("gzip %v", err)
+		}
+		defer gz.Close()
+		r = gz
+	case strings.Contains(encoding, "zstd") || bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(max)))
+		if err != nil {
+			return nil, fmt.Errorf("zstd %v", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	b, err := ioutil.ReadAll(io.LimitReader(r, max+1))
+	if err != nil && !errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+		return nil, err
+	}
+	// the zstd decoder enforces the limit itself (for frames that declare their size)
+	if err != nil || int64(len(b)) > max {
+		return nil, fmt.Errorf("%w (%d bytes)", ErrObjectTooLarge, max)
+	}
+	return b, nil
+}
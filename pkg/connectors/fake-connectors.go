@@ -4,15 +4,26 @@ package connectors
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"reflect"
+	"strings"
 
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/cache"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
 	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	gocb "github.com/couchbase/gocb/v2"
-	"github.com/microlib/simple"
+	"github.com/klauspost/compress/zstd"
 )
 
 // Fake connectors for testing in this package
@@ -26,8 +37,11 @@ type Connectors struct {
 	Bucket    *FakeBucket
 	Cluster   *FakeCluster
 	S3Service *FakeS3
-	Logger    *simple.Logger
+	Logger    *logging.Logger
+	Cache     *cache.Cache
 	Flag      string
+	// the request context (set with WithContext) is the parent of the backend spans
+	ctx context.Context
 }
 
 // FakeCluster
@@ -54,6 +68,11 @@ type FakeResult struct {
 	Force string
 }
 
+// FakeGetResult
+type FakeGetResult struct {
+	Force string
+}
+
 // Fake AWS S3 session
 type FakeS3 struct {
 	Force string
@@ -72,19 +91,107 @@ func (fs3 *FakeS3) GetObject(opts *s3.GetObjectInput) (*s3.GetObjectOutput, erro
 		data, _ = ioutil.ReadFile("../../tests/report-payload.json")
 	}
 	obj = &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewBuffer(data))}
+
+	// compressed objects (gzip is flagged by the content encoding, zstd only has its magic bytes)
+	var buf bytes.Buffer
+	switch fs3.Force {
+	case "gzip":
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		gz.Close()
+		obj = &s3.GetObjectOutput{Body: ioutil.NopCloser(&buf), ContentEncoding: aws.String("gzip")}
+	case "zstd":
+		zw, _ := zstd.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		obj = &s3.GetObjectOutput{Body: ioutil.NopCloser(&buf)}
+	case "corrupt":
+		obj = &s3.GetObjectOutput{Body: ioutil.NopCloser(bytes.NewBuffer([]byte{0x1f, 0x8b, 0x00})), ContentEncoding: aws.String("gzip")}
+	}
 	return obj, nil
 }
 
+// PutObject - reads the body (as the sdk would) and returns a version id
+func (fs3 *FakeS3) PutObject(opts *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	if fs3.Force == "true" || fs3.Force == "put" {
+		return &s3.PutObjectOutput{}, errors.New("Function PutObject forced error")
+	}
+	if _, err := ioutil.ReadAll(opts.Body); err != nil {
+		return &s3.PutObjectOutput{}, err
+	}
+	return &s3.PutObjectOutput{VersionId: aws.String("v3")}, nil
+}
+
+// ListObjectsV2 - returns two pages of keys (the second page when a continuation token is set)
+func (fs3 *FakeS3) ListObjectsV2(opts *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	if fs3.Force == "true" {
+		return &s3.ListObjectsV2Output{}, errors.New("Function ListObjectsV2 forced error")
+	}
+	if opts.ContinuationToken == nil {
+		return &s3.ListObjectsV2Output{
+			Contents:              []*s3.Object{{Key: aws.String(*opts.Prefix + "096esbpfrk8b3nhdlfhditsmk10gj03g06i3c201.json"), Size: aws.Int64(1024)}},
+			IsTruncated:           aws.Bool(true),
+			NextContinuationToken: aws.String("page2"),
+		}, nil
+	}
+	return &s3.ListObjectsV2Output{
+		Contents:    []*s3.Object{{Key: aws.String(*opts.Prefix + "7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1"), Size: aws.Int64(2048)}},
+		IsTruncated: aws.Bool(false),
+	}, nil
+}
+
+// HeadObject - the object exists unless the key ends with missing
+func (fs3 *FakeS3) HeadObject(opts *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	if fs3.Force == "true" {
+		return &s3.HeadObjectOutput{}, errors.New("Function HeadObject forced error")
+	}
+	if strings.HasSuffix(*opts.Key, "missing") {
+		return &s3.HeadObjectOutput{}, awserr.New("NotFound", "Not Found", nil)
+	}
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(1024)}, nil
+}
+
+// ListObjectVersions - returns two versions (and a delete marker) of the key in the prefix
+func (fs3 *FakeS3) ListObjectVersions(opts *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	if fs3.Force == "true" {
+		return &s3.ListObjectVersionsOutput{}, errors.New("Function ListObjectVersions forced error")
+	}
+	return &s3.ListObjectVersionsOutput{
+		Versions: []*s3.ObjectVersion{
+			{Key: opts.Prefix, VersionId: aws.String("v2"), IsLatest: aws.Bool(true), Size: aws.Int64(2048)},
+			{Key: opts.Prefix, VersionId: aws.String("v1"), IsLatest: aws.Bool(false), Size: aws.Int64(1024)},
+		},
+		DeleteMarkers: []*s3.DeleteMarkerEntry{{Key: opts.Prefix, VersionId: aws.String("d1"), IsLatest: aws.Bool(false)}},
+		IsTruncated:   aws.Bool(false),
+	}, nil
+}
+
+// GetObjectRequest - uses a real (offline) s3 client with static credentials so that presigning works
+func (fs3 *FakeS3) GetObjectRequest(opts *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("us-east-1"), Credentials: credentials.NewStaticCredentials("AKID", "SECRET", "")}))
+	req, out := s3.New(sess).GetObjectRequest(opts)
+	if fs3.Force == "true" {
+		req.Error = errors.New("Function GetObjectRequest forced error")
+	}
+	return req, out
+}
+
 // Couchbase fake
 
 // Query - inject our implementation for testing
 func (fc *FakeCluster) Query(query string, opts *gocb.QueryOptions) (*FakeResult, error) {
+	// gocb returns a nil result with the error
 	if fc.Force == "true" {
-		return &FakeResult{}, errors.New("Function Query forced error")
+		return nil, errors.New("Function Query forced error")
 	}
 	return &FakeResult{Force: fc.Force}, nil
 }
 
+// Bucket - override the original gocb implementation
+func (fc *FakeCluster) Bucket(name string) *FakeBucket {
+	return &FakeBucket{Force: fc.Force}
+}
+
 // DefaultCollection - override the original gocb implementation
 func (fb *FakeBucket) DefaultCollection() *FakeCollection {
 	return &FakeCollection{Force: fb.Force}
@@ -102,7 +209,7 @@ func (fr *FakeResult) Next() bool {
 
 // Row - override the original golang implementation
 func (fr *FakeResult) Row(ptr interface{}) error {
-	if fr.Force == "true" {
+	if fr.Force == "true" || fr.Force == "row" {
 		return errors.New("Function Row forced error")
 	}
 	if reflect.TypeOf(ptr).String() == "**schema.Stat" {
@@ -141,6 +248,21 @@ func (fr *FakeResult) Row(ptr interface{}) error {
 		}
 		json.Unmarshal([]byte(data), &stat)
 		*ptr.(**schema.Stat) = stat
+	} else if reflect.TypeOf(ptr).String() == "*string" {
+		*ptr.(*string) = fmt.Sprintf("report-%d.json", count)
+	} else if reflect.TypeOf(ptr).String() == "**schema.AuditRecord" {
+		var ar *schema.AuditRecord
+		data := `{ "id": "audit::096esbpfrk8b3nhdlfhditsmk10gj03g06i3c201.json::1597144108220000000::UserClassification",
+			"Action": "reclassify",
+			"ReportId": "096esbpfrk8b3nhdlfhditsmk10gj03g06i3c201.json",
+			"User": "cduffy@tfd.ie",
+			"Timestamp": 1597144108220,
+			"Field": "UserClassification",
+			"OldValue": "",
+			"NewValue": "No Action"
+		}`
+		json.Unmarshal([]byte(data), &ar)
+		*ptr.(**schema.AuditRecord) = ar
 	} else {
 		var rl *schema.ReportList
 		data := `{ "id": "096esbpfrk8b3nhdlfhditsmk10gj03g06i3c201.json",
@@ -172,8 +294,77 @@ func (fr *FakeResult) Err() error {
 	return nil
 }
 
-// Close - do we need to explain ?
+// Close - do we need to explain ? (a result closed before the last row restarts the fake rows)
 func (fr *FakeResult) Close() {
+	count = 0
+}
+
+// Get : override the original gocb collection get
+func (fc *FakeCollection) Get(id string, opts *gocb.GetOptions) (*FakeGetResult, error) {
+	if fc.Force == "error" {
+		return &FakeGetResult{}, gocb.ErrDocumentNotFound
+	}
+	return &FakeGetResult{Force: fc.Force}, nil
+}
+
+// Replace : override the original gocb collection replace
+func (fc *FakeCollection) Replace(id string, value interface{}, opts *gocb.ReplaceOptions) (*gocb.MutationResult, error) {
+	if fc.Force == "error" {
+		return &gocb.MutationResult{}, errors.New("Forced collection replace error")
+	}
+	if fc.Force == "cas" {
+		return &gocb.MutationResult{}, gocb.ErrCasMismatch
+	}
+	return &gocb.MutationResult{}, nil
+}
+
+// Insert : override the original gocb collection insert
+func (fc *FakeCollection) Insert(id string, value interface{}, opts *gocb.InsertOptions) (*gocb.MutationResult, error) {
+	if fc.Force == "error" {
+		return &gocb.MutationResult{}, errors.New("Forced collection insert error")
+	}
+	if fc.Force == "exists" {
+		return &gocb.MutationResult{}, gocb.ErrDocumentExists
+	}
+	return &gocb.MutationResult{}, nil
+}
+
+// Remove : override the original gocb collection remove
+func (fc *FakeCollection) Remove(id string, opts *gocb.RemoveOptions) (*gocb.MutationResult, error) {
+	if fc.Force == "error" {
+		return &gocb.MutationResult{}, gocb.ErrDocumentNotFound
+	}
+	return &gocb.MutationResult{}, nil
+}
+
+// MutateIn : override the original gocb collection sub-document mutation
+func (fc *FakeCollection) MutateIn(id string, specs []gocb.MutateInSpec, opts *gocb.MutateInOptions) (*gocb.MutateInResult, error) {
+	if fc.Force == "error" {
+		return &gocb.MutateInResult{}, errors.New("Forced collection mutatein error")
+	}
+	if fc.Force == "cas" {
+		return &gocb.MutateInResult{}, gocb.ErrCasMismatch
+	}
+	return &gocb.MutateInResult{}, nil
+}
+
+// Content - override the original gocb implementation
+func (fg *FakeGetResult) Content(ptr interface{}) error {
+	if fg.Force == "content" {
+		return errors.New("Function Content forced error")
+	}
+	data := `{
+		"EmailClassification": "Cancel",
+		"ProcessOutcome": "No Action",
+		"UserClassification": "",
+		"success": false
+	}`
+	return json.Unmarshal([]byte(data), ptr)
+}
+
+// Cas - override the original gocb implementation
+func (fg *FakeGetResult) Cas() gocb.Cas {
+	return gocb.Cas(1612345678901234)
 }
 
 // Upsert : wrapper function for couchbase collection upsert
@@ -183,3 +374,25 @@ func (fc *FakeCollection) Upsert(col string, value interface{}, opts *gocb.Upser
 	}
 	return &gocb.MutationResult{}, nil
 }
+
+// UpdateReports - simulates the transaction (each document is read, updated and replaced in order)
+func (c *Connectors) UpdateReports(ids []string, update func(id string, current *schema.ListObject) error) error {
+	collection := c.Bucket.DefaultCollection()
+	for _, id := range ids {
+		var stats schema.ListObject
+		res, err := collection.Get(id, &gocb.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if err = res.Content(&stats); err != nil {
+			return err
+		}
+		if err = update(id, &stats); err != nil {
+			return err
+		}
+		if _, err = collection.Replace(id, stats, &gocb.ReplaceOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,14 +3,19 @@
 package connectors
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strings"
 
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/buckets"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/cache"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	gocb "github.com/couchbase/gocb/v2"
-	"github.com/microlib/simple"
 )
 
 // Real "runtime" client connections
@@ -20,12 +25,15 @@ type Connectors struct {
 	S3Service *s3.S3
 	Bucket    *gocb.Bucket
 	Cluster   *gocb.Cluster
-	Logger    *simple.Logger
+	Logger    *logging.Logger
+	Cache     *cache.Cache
 	Mode      string
+	// the request context (set with WithContext) is the parent of the backend spans
+	ctx context.Context
 }
 
 // NewClientConnections - fucntion that creates all client connections and returns the interface
-func NewClientConnections(logger *simple.Logger) Clients {
+func NewClientConnections(logger *logging.Logger) Clients {
 	// setup aws session
 	sess, err := session.NewSession(&aws.Config{Region: aws.String(os.Getenv("AWS_REGION"))})
 	if err != nil {
@@ -35,9 +43,15 @@ func NewClientConnections(logger *simple.Logger) Clients {
 
 	svc := s3.New(sess)
 
+	txnBucket := os.Getenv(TXNBUCKET)
+	if txnBucket == "" {
+		txnBucket = DEFAULTTXNBUCKET
+	}
 	opts := gocb.ClusterOptions{
 		Username: os.Getenv("COUCHBASE_USER"),
 		Password: os.Getenv("COUCHBASE_PASSWORD"),
+		// the active transaction records are written to their own bucket
+		TransactionsConfig: gocb.TransactionsConfig{MetadataCollection: &gocb.TransactionKeyspace{BucketName: txnBucket}},
 	}
 	cluster, err := gocb.Connect(os.Getenv("COUCHBASE_HOST"), opts)
 	if err != nil {
@@ -47,8 +61,48 @@ func NewClientConnections(logger *simple.Logger) Clients {
 
 	// get a bucket reference
 	// bucket := cluster.Bucket(os.Getenv("COUCHBASE_BUCKET"), &gocb.BucketOptions{}) v.2.0.0-beta-1
-	bucket := cluster.Bucket(os.Getenv("COUCHBASE_BUCKET"))
+	bucket := cluster.Bucket(os.Getenv(buckets.STATSBUCKET))
 	logger.Info(fmt.Sprintf("Couchbase connection: %v", bucket))
 
-	return &Connectors{Bucket: bucket, Cluster: cluster, S3Service: svc, Logger: logger}
+	con := &Connectors{Bucket: bucket, Cluster: cluster, S3Service: svc, Logger: logger, Cache: cache.Get()}
+
+	// the shared cache is optional (replicas share the downloaded reports)
+	if os.Getenv(cache.REPORTCACHEBUCKET) != "" {
+		con.Cache.SetShared(NewSharedCache(con, os.Getenv(cache.REPORTCACHEBUCKET)))
+		logger.Info(fmt.Sprintf("Report cache : shared on couchbase bucket %s", os.Getenv(cache.REPORTCACHEBUCKET)))
+	}
+	return con
+}
+
+// UpdateReports - reads, updates and replaces the stats document of every report in one couchbase transaction
+// either all documents are committed or none are, update can be called more than once for an id (the transaction is retried
+// on transient errors) so it must only change the document it is passed, an error returned by update aborts the transaction
+func (c *Connectors) UpdateReports(ids []string, update func(id string, current *schema.ListObject) error) error {
+	var err error
+	_, call := startCall(c.ctx, "couchbase", "Transaction", couchbaseAttributes("transaction", strings.Join(ids, ","))...)
+	defer call.end(&err)
+	collection := c.Bucket.DefaultCollection()
+	_, err = c.Cluster.Transactions().Run(func(tx *gocb.TransactionAttemptContext) error {
+		for _, id := range ids {
+			var stats schema.ListObject
+			doc, err := tx.Get(collection, id)
+			if err != nil {
+				return err
+			}
+			if err := doc.Content(&stats); err != nil {
+				return err
+			}
+			if err := update(id, &stats); err != nil {
+				return err
+			}
+			if _, err := tx.Replace(doc, stats); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		c.Error("Function UpdateReports %v", err)
+	}
+	return err
 }
@@ -0,0 +1,191 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// ErrAttachmentNotFound - returned when the attachment index is out of range
+var ErrAttachmentNotFound = errors.New("attachment not found")
+
+// Attachment - a decoded attachment (used for the download)
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// part - a decoded leaf part of the message
+type part struct {
+	contentType string
+	disposition string
+	filename    string
+	contentId   string
+	data        []byte
+}
+
+// Parse - parses the raw (mime) email into a structured view
+// html is sanitized, attachments are listed (by index) but not returned
+func Parse(raw []byte) (*schema.EmailView, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+
+	dec := new(mime.WordDecoder)
+	view := &schema.EmailView{Headers: make(map[string][]string)}
+	for name, values := range msg.Header {
+		for _, v := range values {
+			view.Headers[name] = append(view.Headers[name], decodeHeader(dec, v))
+		}
+	}
+	view.From = decodeHeader(dec, msg.Header.Get("From"))
+	view.To = decodeHeader(dec, msg.Header.Get("To"))
+	view.Cc = decodeHeader(dec, msg.Header.Get("Cc"))
+	view.Subject = decodeHeader(dec, msg.Header.Get("Subject"))
+	view.Date = msg.Header.Get("Date")
+	view.MessageId = msg.Header.Get("Message-Id")
+
+	parts, err := walk(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Header.Get("Content-Disposition"), "", msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	text, html, attachments := classify(parts)
+	if text != nil {
+		view.Text = string(text.data)
+	}
+	if html != nil {
+		view.Html = bluemonday.UGCPolicy().Sanitize(string(html.data))
+	}
+	for i, p := range attachments {
+		view.Attachments = append(view.Attachments, schema.EmailAttachment{
+			Index:       i,
+			Filename:    p.filename,
+			ContentType: p.contentType,
+			ContentId:   p.contentId,
+			Size:        len(p.data),
+		})
+	}
+	return view, nil
+}
+
+// GetAttachment - returns the decoded attachment at index (as listed by Parse)
+func GetAttachment(raw []byte, index int) (*Attachment, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	parts, err := walk(msg.Header.Get("Content-Type"), msg.Header.Get("Content-Transfer-Encoding"), msg.Header.Get("Content-Disposition"), "", msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, attachments := classify(parts)
+	if index < 0 || index >= len(attachments) {
+		return nil, fmt.Errorf("%w : index %d", ErrAttachmentNotFound, index)
+	}
+	p := attachments[index]
+	return &Attachment{Filename: p.filename, ContentType: p.contentType, Data: p.data}, nil
+}
+
+// classify - private function, the first inline text and html parts are the body, everything else is an attachment
+func classify(parts []part) (*part, *part, []part) {
+	var text, html *part
+	var attachments []part
+	for i := range parts {
+		p := &parts[i]
+		inline := p.disposition != "attachment" && p.filename == ""
+		switch {
+		case inline && p.contentType == "text/plain" && text == nil:
+			text = p
+		case inline && p.contentType == "text/html" && html == nil:
+			html = p
+		default:
+			attachments = append(attachments, *p)
+		}
+	}
+	return text, html, attachments
+}
+
+// walk - private function, recursively decodes the (multipart) body into leaf parts
+func walk(contentType string, encoding string, disposition string, contentId string, body io.Reader) ([]part, error) {
+	var parts []part
+
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return parts, err
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return parts, err
+			}
+			// multipart.Reader has already decoded (and removed) a quoted-printable encoding
+			children, err := walk(p.Header.Get("Content-Type"), p.Header.Get("Content-Transfer-Encoding"), p.Header.Get("Content-Disposition"), p.Header.Get("Content-Id"), p)
+			if err != nil {
+				return parts, err
+			}
+			parts = append(parts, children...)
+		}
+		return parts, nil
+	}
+
+	data, err := ioutil.ReadAll(decodeTransfer(encoding, body))
+	if err != nil {
+		return parts, err
+	}
+	leaf := part{contentType: mediaType, data: data, filename: params["name"], contentId: strings.Trim(contentId, "<>")}
+	if disposition != "" {
+		d, dparams, err := mime.ParseMediaType(disposition)
+		if err == nil {
+			leaf.disposition = d
+			if dparams["filename"] != "" {
+				leaf.filename = dparams["filename"]
+			}
+		}
+	}
+	parts = append(parts, leaf)
+	return parts, nil
+}
+
+// decodeTransfer - private function, wraps the reader with the content transfer decoder
+func decodeTransfer(encoding string, body io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		return quotedprintable.NewReader(body)
+	}
+	return body
+}
+
+// decodeHeader - private function, decodes rfc 2047 encoded words (returns the raw value on error)
+func decodeHeader(dec *mime.WordDecoder, value string) string {
+	decoded, err := dec.DecodeHeader(value)
+	if err != nil {
+		return value
+	}
+	return decoded
+}
@@ -0,0 +1,62 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// TestEmail - test entry point
+func TestEmail(t *testing.T) {
+
+	raw, _ := ioutil.ReadFile("../../tests/email-multipart.eml")
+
+	t.Run("Parse : should pass", func(t *testing.T) {
+		view, err := Parse(raw)
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Function %s returned with error - got (%v) wanted (%v)", "Parse", err, nil))
+		}
+		if view.Subject != "Cancel Subscription – Green Zone" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect subject - got (%s) wanted (%s)", "Parse", view.Subject, "Cancel Subscription – Green Zone"))
+		}
+		if !strings.Contains(view.Text, "Green Zone Fortunes.\n\nRegards") {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect text - got (%s) wanted (%s)", "Parse", view.Text, "decoded quoted-printable"))
+		}
+		if strings.Contains(view.Html, "<script") || strings.Contains(view.Html, "onclick") || !strings.Contains(view.Html, "Please cancel") {
+			t.Errorf(fmt.Sprintf("Function %s returned unsanitized html - got (%s) wanted (%s)", "Parse", view.Html, "sanitized"))
+		}
+		if len(view.Attachments) != 1 || view.Attachments[0].Filename != "invoice.txt" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect attachments - got (%v) wanted (%s)", "Parse", view.Attachments, "invoice.txt"))
+		}
+	})
+
+	t.Run("Parse : should pass (single part)", func(t *testing.T) {
+		view, err := Parse([]byte("From: a@example.com\r\nSubject: test\r\n\r\nhello"))
+		if err != nil || view.Text != "hello" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect text - got (%v, %v) wanted (%s)", "Parse", view, err, "hello"))
+		}
+	})
+
+	t.Run("Parse : should fail", func(t *testing.T) {
+		_, err := Parse([]byte("Content-Type: multipart/mixed; boundary=\"x\"\r\n\r\n--y\r\n"))
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Parse", err, "error"))
+		}
+	})
+
+	t.Run("GetAttachment : should pass", func(t *testing.T) {
+		a, err := GetAttachment(raw, 0)
+		if err != nil || string(a.Data) != "Invoice 12345\n" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect data - got (%v, %v) wanted (%s)", "GetAttachment", a, err, "Invoice 12345"))
+		}
+	})
+
+	t.Run("GetAttachment : should fail (index)", func(t *testing.T) {
+		_, err := GetAttachment(raw, 3)
+		if !errors.Is(err, ErrAttachmentNotFound) {
+			t.Errorf(fmt.Sprintf("Function %s returned with incorrect error - got (%v) wanted (%v)", "GetAttachment", err, ErrAttachmentNotFound))
+		}
+	})
+}
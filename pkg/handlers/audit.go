@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/buckets"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/redact"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	gocb "github.com/couchbase/gocb/v2"
+	"github.com/gorilla/mux"
+)
+
+const (
+	AUDITBUCKET string = buckets.AUDIT
+	RECLASSIFY  string = "reclassify"
+	PRESIGN     string = "presign"
+	ATTACHMENT  string = "attachment"
+	AUDIT       string = "Audit"
+)
+
+// errAuditDeferred - the audit record was dead-lettered (it is replayed into the audit bucket)
+var errAuditDeferred = errors.New("audit record deferred to the dead-letter bucket")
+
+// errAuditUser - the audit history of another user was requested by a role that can't unmask
+var errAuditUser = errors.New("role is not allowed to read the audit history of another user")
+
+// AuditHandler - handler that returns the (paginated) audit history for a report or a user
+// a user's history is only returned to that user or to a role that can unmask (the redaction role config)
+func AuditHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	var servisbotRequest *schema.ServisBOTRequest
+	vars := mux.Vars(r)
+	addHeaders(w, r)
+
+	// read the jwt token data in the body
+	// we don't use authorization header as the token can get quite large due to form data
+	// ensure we don't have nil - it will cause a null pointer exception
+	if r.Body == nil {
+		r.Body = ioutil.NopCloser(bytes.NewBufferString(""))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "AuditHandler body data error : %v"
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	con.TraceBody("AuditHandler request body : %s", body)
+
+	errs := json.Unmarshal(body, &servisbotRequest)
+	if errs != nil {
+		msg := "AuditHandler could not unmarshal input data from servisBOT to schema %v"
+		con.Error(msg, errs)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, errs)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// check the jwt token
+	creds, err := verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
+	if err != nil {
+		msg := "AuditHandler verifyToken  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// offset and limit are used directly in the query so they must be numeric
+	for _, v := range []string{vars["offset"], vars["limit"]} {
+		if _, err := strconv.ParseUint(v, 10, 32); err != nil {
+			msg := "AuditHandler offset/limit %v"
+			con.Error(msg, err)
+			b := responseErrorFormat(http.StatusBadRequest, w, msg, err)
+			fmt.Fprintf(w, string(b))
+			return
+		}
+	}
+
+	field, value := "ReportId", vars["id"]
+	if value == "" {
+		field, value = "User", vars["user"]
+		if creds.User != value && !redact.Get().CanUnmask(creds.Role) {
+			msg := "AuditHandler %v"
+			con.Error(msg, errAuditUser)
+			b := responseErrorFormat(http.StatusForbidden, w, msg, errAuditUser)
+			fmt.Fprintf(w, string(b))
+			return
+		}
+	}
+
+	res, err := con.GetAuditList(field, value, vars["offset"], vars["limit"])
+	if err != nil {
+		msg := "AuditHandler (get) couchbase  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	response := &schema.AuditResponse{Code: http.StatusOK, Status: "OK", Message: "AuditHandler retrieved data successfully", Records: res}
+	w.WriteHeader(http.StatusOK)
+	b, _ := json.MarshalIndent(response, "", "	")
+	fmt.Fprintf(w, string(b))
+	return
+}
+
+// writeAudit - private function, inserts an immutable audit record for each changed field
+// the update has already been applied at this point, a record that can't be inserted is dead-lettered (for replay)
+// errAuditDeferred is returned when a record was dead-lettered, any other error means a record was lost (the caller must report both)
+func writeAudit(con connectors.Clients, creds *schema.Credentials, id string, old schema.ListObject, changes map[string]string) error {
+	var fields []string
+	for field := range changes {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	var result error
+	for _, field := range fields {
+		record := auditRecord(creds, RECLASSIFY, id, field, fieldValue(old, field), changes[field])
+		err := insertAuditRecord(con, record)
+		if err == nil {
+			continue
+		}
+		if dlErr := auditDeadLetter(con, record, err); dlErr != nil {
+			result = fmt.Errorf("audit record %s could not be written (%v) or dead-lettered (%v)", record.Id, err, dlErr)
+			continue
+		}
+		if result == nil {
+			result = fmt.Errorf("%w (%v)", errAuditDeferred, err)
+		}
+	}
+	return result
+}
+
+// insertAudit - private function, inserts a single immutable audit record
+func insertAudit(con connectors.Clients, creds *schema.Credentials, action string, id string, field string, old string, new string) error {
+	return insertAuditRecord(con, auditRecord(creds, action, id, field, old, new))
+}
+
+// auditRecord - private function
+func auditRecord(creds *schema.Credentials, action string, id string, field string, old string, new string) *schema.AuditRecord {
+	now := time.Now()
+	return &schema.AuditRecord{
+		Id:             fmt.Sprintf("audit::%s::%d::%s", id, now.UnixNano(), field),
+		Action:         action,
+		ReportId:       id,
+		User:           creds.User,
+		CustomerNumber: creds.CustomerNumber,
+		Timestamp:      now.UnixNano() / int64(time.Millisecond),
+		Field:          field,
+		OldValue:       old,
+		NewValue:       new,
+	}
+}
+
+// insertAuditRecord - private function
+func insertAuditRecord(con connectors.Clients, record *schema.AuditRecord) error {
+	_, err := con.Insert(AUDITBUCKET, record.Id, record, &gocb.InsertOptions{})
+	if err != nil {
+		con.Error("Function insertAudit (insert) couchbase %v", err)
+	}
+	return err
+}
+
+// auditDeadLetter - private function, stores the audit record that could not be inserted (for replay)
+func auditDeadLetter(con connectors.Clients, record *schema.AuditRecord, cause error) error {
+	dl := &schema.DeadLetter{
+		Id:        "deadletter::" + record.Id,
+		Bucket:    AUDITBUCKET,
+		Key:       record.Id,
+		EventName: AUDIT,
+		Error:     cause.Error(),
+		Timestamp: record.Timestamp,
+		Audit:     record,
+	}
+	_, err := con.Insert(DEADLETTERBUCKET, dl.Id, dl, &gocb.InsertOptions{})
+	if err != nil {
+		con.Error("Function auditDeadLetter (insert) couchbase %v", err)
+	}
+	return err
+}
+
+// auditResponse - private function, the response of an applied update with the outcome of its audit records
+// a dead-lettered record is reported in the message, a lost record is a 500 (with the new cas as the update was applied)
+func auditResponse(name string, msg string, cas schema.Cas, err error) *schema.Response {
+	switch {
+	case err == nil:
+		return &schema.Response{Code: http.StatusOK, Status: "OK", Message: msg, Cas: cas}
+	case errors.Is(err, errAuditDeferred):
+		return &schema.Response{Code: http.StatusOK, Status: "OK", Message: fmt.Sprintf("%s, %v", msg, err), Cas: cas}
+	}
+	return &schema.Response{Code: http.StatusInternalServerError, Status: "ERROR", Message: fmt.Sprintf("%s the update was applied but %v", name, err), Cas: cas}
+}
+
+// changedFields - private function, returns the reviewer owned fields that differ between old and new
+func changedFields(old schema.ListObject, new schema.ListObject) map[string]string {
+	changes := make(map[string]string)
+	for field := range reviewerFields {
+		if fieldValue(old, field) != fieldValue(new, field) {
+			changes[field] = fieldValue(new, field)
+		}
+	}
+	return changes
+}
+
+// fieldValue - private function, returns the value of a reviewer owned field
+func fieldValue(lo schema.ListObject, field string) string {
+	switch field {
+	case "UserClassification":
+		return lo.UserClassification
+	case "ReviewerNotes":
+		return lo.ReviewerNotes
+	}
+	return ""
+}
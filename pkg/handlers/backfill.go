@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"github.com/aws/aws-sdk-go/service/s3"
+	gocb "github.com/couchbase/gocb/v2"
+)
+
+// BACKFILLMAXRATE - the highest rate (objects per second) a backfill can be limited to
+const BACKFILLMAXRATE int = 1000
+
+// BackfillOptions - the backfill command flags
+type BackfillOptions struct {
+	Bucket     string
+	Prefix     string
+	Workers    int
+	Rate       int
+	Checkpoint string
+}
+
+// Validate - checks the flags (the rate is the ticker interval so it must stay well above a nanosecond)
+func (opts BackfillOptions) Validate() error {
+	if opts.Rate < 0 || opts.Rate > BACKFILLMAXRATE {
+		return fmt.Errorf("rate %d must be between 0 (unlimited) and %d objects per second", opts.Rate, BACKFILLMAXRATE)
+	}
+	return nil
+}
+
+// Backfill - rebuilds the servisbotstats documents from every report object in the bucket (and prefix)
+// objects are processed page by page with Workers in parallel and at most Rate objects per second (0 is unlimited)
+// new documents get the full projection, existing documents only get the bot owned fields (reviewer changes are kept)
+// the last key of each completed page is written to the checkpoint file so that an interrupted run can resume
+func Backfill(con connectors.Clients, opts BackfillOptions) (*schema.BackfillReport, error) {
+	if err := opts.Validate(); err != nil {
+		return &schema.BackfillReport{Bucket: opts.Bucket, Prefix: opts.Prefix}, err
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	report, err := backfillCheckpoint(opts)
+	if err != nil {
+		return report, err
+	}
+	if report.StartAfter != "" {
+		con.Info("Backfill resuming after %s (%d objects already processed)", report.StartAfter, report.Objects)
+	}
+
+	var tick <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(opts.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	// prefixes are processed in order so that the checkpoint key also tells which prefixes are done
+	prefixes := []string{opts.Prefix}
+	if opts.Prefix == "" {
+		prefixes = nil
+		for _, prefix := range channelPrefixes() {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Strings(prefixes)
+	}
+
+	for i := range prefixes {
+		input := &s3.ListObjectsV2Input{Bucket: &opts.Bucket, Prefix: &prefixes[i]}
+		if report.StartAfter > prefixes[i] {
+			input.StartAfter = &report.StartAfter
+		}
+		for {
+			out, err := con.ListObjects(input)
+			if err != nil {
+				return report, err
+			}
+			backfillPage(con, opts, out.Contents, tick, report)
+			if len(out.Contents) > 0 {
+				report.StartAfter = *out.Contents[len(out.Contents)-1].Key
+				if err := backfillSave(opts.Checkpoint, report); err != nil {
+					return report, err
+				}
+			}
+			con.Info("Backfill processed %d objects (%d inserted %d updated %d failed) last key %s", report.Objects, report.Inserted, report.Updated, report.Failed, report.StartAfter)
+			if out.IsTruncated == nil || !*out.IsTruncated {
+				break
+			}
+			input.ContinuationToken = out.NextContinuationToken
+		}
+	}
+
+	report.Finished = time.Now().Unix()
+	return report, backfillSave(opts.Checkpoint, report)
+}
+
+// backfillPage - private function, processes the objects of a single page with bounded parallelism
+func backfillPage(con connectors.Clients, opts BackfillOptions, objects []*s3.Object, tick <-chan time.Time, report *schema.BackfillReport) {
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sem := make(chan struct{}, opts.Workers)
+
+	for _, obj := range objects {
+		if tick != nil {
+			<-tick
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			status, err := backfillObject(con, opts.Bucket, key)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Objects++
+			switch {
+			case err != nil:
+				con.Error("Backfill %s %v", key, err)
+				report.Failed++
+			case status == "UPDATED":
+				report.Updated++
+			default:
+				report.Inserted++
+			}
+		}(*obj.Key)
+	}
+	wg.Wait()
+}
+
+// backfillObject - private function, inserts the projection or (for an existing document) updates the bot owned fields
+func backfillObject(con connectors.Clients, bucket string, key string) (string, error) {
+	id, projection, err := projectObject(con, bucket, key)
+	if err != nil {
+		return "", err
+	}
+	_, err = con.Insert(os.Getenv(COUCHBASEBUCKET), id, projection, &gocb.InsertOptions{})
+	if err == nil {
+		return "INSERTED", nil
+	}
+	if !errors.Is(err, gocb.ErrDocumentExists) {
+		return "", err
+	}
+
+	err = updateBotFields(con, id, projection)
+	if err != nil {
+		return "", err
+	}
+	return "UPDATED", nil
+}
+
+// updateBotFields - private function, upserts the bot owned fields (including the email summary) of an existing document
+// the reviewer owned fields are left as is, so writing the same projection again gives the same document
+func updateBotFields(con connectors.Clients, id string, projection *schema.ListObject) error {
+	values := map[string]interface{}{
+		"ProcessOutcome":      projection.ProcessOutcome,
+		"EmailClassification": projection.EmailClassification,
+		"Success":             projection.Success,
+		"Timestamp":           projection.Timestamp,
+		"AffiliateId":         projection.AffiliateId,
+		"Channel":             projection.Channel,
+		"Subject":             projection.Subject,
+		"Sender":              projection.Sender,
+		"CustomerNumber":      projection.CustomerNumber,
+		"Preview":             projection.Preview,
+		"EmailS3Key":          projection.EmailS3Key,
+	}
+	var fields []string
+	for field := range values {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	var specs []gocb.MutateInSpec
+	for _, field := range fields {
+		specs = append(specs, gocb.UpsertSpec(field, values[field], &gocb.UpsertSpecOptions{}))
+	}
+	_, err := con.MutateIn(id, specs, &gocb.MutateInOptions{})
+	return err
+}
+
+// backfillCheckpoint - private function, returns the saved progress (or a new report when there is no checkpoint)
+func backfillCheckpoint(opts BackfillOptions) (*schema.BackfillReport, error) {
+	report := &schema.BackfillReport{Bucket: opts.Bucket, Prefix: opts.Prefix, Started: time.Now().Unix()}
+	if opts.Checkpoint == "" {
+		return report, nil
+	}
+	b, err := ioutil.ReadFile(opts.Checkpoint)
+	if os.IsNotExist(err) {
+		return report, nil
+	}
+	if err != nil {
+		return report, err
+	}
+	var saved *schema.BackfillReport
+	err = json.Unmarshal(b, &saved)
+	if err != nil {
+		return report, err
+	}
+	if saved.Bucket != opts.Bucket || saved.Prefix != opts.Prefix {
+		return report, fmt.Errorf("checkpoint %s is for bucket %s prefix %q (remove it to start again)", opts.Checkpoint, saved.Bucket, saved.Prefix)
+	}
+	// a finished run starts again from the beginning
+	if saved.Finished != 0 {
+		return report, nil
+	}
+	return saved, nil
+}
+
+// backfillSave - private function, writes the checkpoint (a temporary file is renamed so that it is never partial)
+func backfillSave(path string, report *schema.BackfillReport) error {
+	if path == "" {
+		return nil
+	}
+	b, _ := json.MarshalIndent(report, "", "	")
+	err := ioutil.WriteFile(path+".tmp", b, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
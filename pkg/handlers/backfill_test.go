@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+)
+
+// TestBackfill - backfill test entry point
+func TestBackfill(t *testing.T) {
+
+	logger := &logging.Logger{Level: "trace"}
+
+	t.Run("Backfill : should pass (new documents)", func(t *testing.T) {
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+		conn := NewTestConnectors(200, logger)
+		report, err := Backfill(conn, BackfillOptions{Bucket: "servisbot", Workers: 2, Rate: 100, Checkpoint: checkpoint})
+		if err != nil || report.Objects != 2 || report.Inserted != 2 || report.Failed != 0 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect report - got (%v %v)", "Backfill", report, err))
+		}
+		var saved *schema.BackfillReport
+		b, _ := ioutil.ReadFile(checkpoint)
+		json.Unmarshal(b, &saved)
+		if saved == nil || saved.Finished == 0 || saved.StartAfter != "Email/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1" {
+			t.Errorf(fmt.Sprintf("Function %s saved incorrect checkpoint - got (%s)", "Backfill", string(b)))
+		}
+	})
+
+	t.Run("Backfill : should pass (existing documents keep reviewer fields)", func(t *testing.T) {
+		conn := NewTestConnectors(200, logger)
+		conn.Meta("exists")
+		report, err := Backfill(conn, BackfillOptions{Bucket: "servisbot", Prefix: "Email/", Workers: 4})
+		if err != nil || report.Objects != 2 || report.Updated != 2 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect report - got (%v %v)", "Backfill", report, err))
+		}
+	})
+
+	t.Run("Backfill : should pass (resume from checkpoint)", func(t *testing.T) {
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+		saved := &schema.BackfillReport{Bucket: "servisbot", StartAfter: "Email/096esbpfrk8b3nhdlfhditsmk10gj03g06i3c201.json", Objects: 1, Inserted: 1, Started: 1597144108}
+		b, _ := json.Marshal(saved)
+		ioutil.WriteFile(checkpoint, b, 0644)
+		conn := NewTestConnectors(200, logger)
+		report, err := Backfill(conn, BackfillOptions{Bucket: "servisbot", Workers: 2, Checkpoint: checkpoint})
+		if err != nil || report.Objects != 2 || report.Inserted != 2 || report.Started != 1597144108 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect report - got (%v %v)", "Backfill", report, err))
+		}
+	})
+
+	t.Run("Backfill : should pass (failed objects are counted)", func(t *testing.T) {
+		conn := NewTestConnectors(200, logger)
+		conn.Meta("nosuchkey")
+		report, err := Backfill(conn, BackfillOptions{Bucket: "servisbot", Workers: 2})
+		if err != nil || report.Objects != 2 || report.Failed != 2 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect report - got (%v %v)", "Backfill", report, err))
+		}
+	})
+
+	t.Run("Backfill : should fail (checkpoint for another bucket)", func(t *testing.T) {
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+		ioutil.WriteFile(checkpoint, []byte(`{"bucket":"other","startAfter":"Email/1"}`), 0644)
+		conn := NewTestConnectors(200, logger)
+		_, err := Backfill(conn, BackfillOptions{Bucket: "servisbot", Checkpoint: checkpoint})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Backfill", err, "error"))
+		}
+	})
+
+	t.Run("Backfill : should fail (invalid checkpoint)", func(t *testing.T) {
+		checkpoint := filepath.Join(t.TempDir(), "checkpoint.json")
+		ioutil.WriteFile(checkpoint, []byte(`{"bucket":`), 0644)
+		conn := NewTestConnectors(200, logger)
+		_, err := Backfill(conn, BackfillOptions{Bucket: "servisbot", Checkpoint: checkpoint})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Backfill", err, "error"))
+		}
+	})
+
+	t.Run("Backfill : should fail (s3 list error)", func(t *testing.T) {
+		conn := NewTestConnectors(200, logger)
+		conn.Meta("list")
+		_, err := Backfill(conn, BackfillOptions{Bucket: "servisbot"})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Backfill", err, "error"))
+		}
+	})
+
+	t.Run("Backfill : should fail (rate above the maximum, the ticker interval would be 0)", func(t *testing.T) {
+		conn := NewTestConnectors(200, logger)
+		for _, rate := range []int{-1, BACKFILLMAXRATE + 1, 2000000000} {
+			_, err := Backfill(conn, BackfillOptions{Bucket: "servisbot", Rate: rate})
+			if err == nil {
+				t.Errorf(fmt.Sprintf("Function %s returned with no error for rate %d - got (%v) wanted (%s)", "Backfill", rate, err, "error"))
+			}
+		}
+		if err := (BackfillOptions{Rate: BACKFILLMAXRATE}).Validate(); err != nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with error - got (%v) wanted (%v)", "Validate", err, nil))
+		}
+	})
+}
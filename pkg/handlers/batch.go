@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/redact"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+)
+
+const (
+	BATCHWORKERS string = "BATCH_WORKERS"
+	BATCHMAXIDS  string = "BATCH_MAX_IDS"
+)
+
+// BatchReportHandler - handler that fetches many report objects in one call (i.e the review UI side panels)
+// the objects are fetched concurrently (bounded by BATCH_WORKERS) and a result is returned per id
+// a failed id doesn't fail the request, the reports are redacted (unless unmasked) as in ReportObjectHandler
+func BatchReportHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	var batchRequest *schema.BatchRequest
+	addHeaders(w, r)
+
+	// read the jwt token data in the body
+	// we don't use authorization header as the token can get quite large due to form data
+	// ensure we don't have nil - it will cause a null pointer exception
+	if r.Body == nil {
+		r.Body = ioutil.NopCloser(bytes.NewBufferString(""))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "BatchReportHandler body data error : %v"
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	con.TraceBody("BatchReportHandler request body : %s", body)
+
+	errs := json.Unmarshal(body, &batchRequest)
+	if errs != nil {
+		msg := "BatchReportHandler could not unmarshal input data from servisBOT to schema %v"
+		con.Error(msg, errs)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, errs)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// check the jwt token
+	creds, err := verifyJwtToken(r.Context(), batchRequest.JwtToken)
+	if err != nil {
+		msg := "BatchReportHandler verifyToken  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	max := envInt(BATCHMAXIDS, 25)
+	if len(batchRequest.Ids) == 0 || len(batchRequest.Ids) > max {
+		msg := "BatchReportHandler %v"
+		err = fmt.Errorf("ids must contain between 1 and %d entries", max)
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusBadRequest, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// the unmask privilege is checked once for the whole batch (each unmasked id is still audited)
+	if batchRequest.Unmask && !redact.Get().CanUnmask(creds.Role) {
+		msg := "BatchReportHandler unmask %v"
+		con.Error(msg, redact.ErrUnmaskDenied)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, redact.ErrUnmaskDenied)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	results := batchFetch(con, creds, batchRequest, envInt(BATCHWORKERS, 8))
+	found := 0
+	for _, result := range results {
+		if result.Code == http.StatusOK {
+			found++
+		}
+	}
+
+	response := &schema.BatchResponse{Code: http.StatusOK, Status: "OK", Message: fmt.Sprintf("BatchReportHandler fetched %d of %d reports", found, len(results)), Results: results}
+	w.WriteHeader(http.StatusOK)
+	b, _ := json.MarshalIndent(response, "", "	")
+	fmt.Fprintf(w, string(b))
+	return
+}
+
+// batchFetch - private function, fetches each report independently with bounded parallelism (results keep the request order)
+func batchFetch(con connectors.Clients, creds *schema.Credentials, batchRequest *schema.BatchRequest, workers int) []schema.BatchResult {
+	var wg sync.WaitGroup
+	results := make([]schema.BatchResult, len(batchRequest.Ids))
+	sem := make(chan struct{}, workers)
+
+	for i := range batchRequest.Ids {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = batchReport(con, creds, &schema.ServisBOTRequest{Data: schema.ReportList{Id: batchRequest.Ids[i]}, Unmask: batchRequest.Unmask})
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// batchReport - private function, fetches (and redacts) a single report
+func batchReport(con connectors.Clients, creds *schema.Credentials, servisbotRequest *schema.ServisBOTRequest) schema.BatchResult {
+	id := servisbotRequest.Data.Id
+	if id == "" {
+		return schema.BatchResult{Id: id, Code: http.StatusBadRequest, Status: "ERROR", Message: "id is mandatory"}
+	}
+
+	unmasked, code, err := checkUnmask(con, creds, servisbotRequest, "ReportContent")
+	if err != nil {
+		return schema.BatchResult{Id: id, Code: code, Status: "ERROR", Message: err.Error()}
+	}
+
+	data, cas, code, err := reportContent(con, servisbotRequest)
+	if err != nil {
+		con.Error("Function batchReport %s %v", id, err)
+		return schema.BatchResult{Id: id, Code: code, Status: "ERROR", Message: err.Error()}
+	}
+	if !unmasked {
+		data = redact.Get().Report(creds.Role, data)
+	}
+	return schema.BatchResult{Id: id, Code: http.StatusOK, Status: "OK", Cas: cas, Report: data}
+}
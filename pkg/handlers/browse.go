@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	BROWSEMAXKEYS string = "BROWSE_MAX_KEYS"
+	BROWSESOURCE  string = "source"
+	BROWSEREPORT  string = "report"
+)
+
+// BrowseHandler - handler that lists a page of the report (source) bucket or the write-back (report) bucket
+// so that operators can see what the bot has written without the aws console
+// each object is flagged with whether the report has a servisbotstats document
+func BrowseHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	var browseRequest *schema.BrowseRequest
+	addHeaders(w, r)
+
+	// ensure we don't have nil - it will cause a null pointer exception
+	if r.Body == nil {
+		r.Body = ioutil.NopCloser(bytes.NewBufferString(""))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "BrowseHandler body data %v"
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	con.TraceBody("BrowseHandler request body : %s", body)
+
+	errs := json.Unmarshal(body, &browseRequest)
+	if errs != nil {
+		msg := "BrowseHandler could not unmarshal input data from servisBOT to schema %v"
+		con.Error(msg, errs)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, errs)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// check the jwt token
+	_, err = verifyJwtToken(r.Context(), browseRequest.JwtToken)
+	if err != nil {
+		msg := "BrowseHandler verifyToken  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	input, err := browseInput(browseRequest)
+	if err != nil {
+		msg := "BrowseHandler %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusBadRequest, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	out, err := con.ListObjects(input)
+	if err != nil {
+		msg := "BrowseHandler (list) s3 %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	objects, err := browseObjects(con, out, browseRequest.From, browseRequest.To)
+	if err != nil {
+		msg := "BrowseHandler (existing) couchbase %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	response := &schema.BrowseResponse{Code: http.StatusOK, Status: "OK", Message: fmt.Sprintf("BrowseHandler listed %d objects", len(objects)), Bucket: *input.Bucket, Prefix: *input.Prefix, Objects: objects}
+	for _, prefix := range out.CommonPrefixes {
+		response.Prefixes = append(response.Prefixes, aws.StringValue(prefix.Prefix))
+	}
+	if aws.BoolValue(out.IsTruncated) {
+		response.NextToken = aws.StringValue(out.NextContinuationToken)
+	}
+	w.WriteHeader(http.StatusOK)
+	b, _ := json.MarshalIndent(response, "", "	")
+	fmt.Fprintf(w, string(b))
+	return
+}
+
+// browseInput - private function, maps the request to a (single page) s3 listing of the selected bucket
+func browseInput(browseRequest *schema.BrowseRequest) (*s3.ListObjectsV2Input, error) {
+	var bucket string
+	switch browseRequest.Bucket {
+	case "", BROWSESOURCE:
+		bucket = os.Getenv(AWSBUCKET)
+	case BROWSEREPORT:
+		bucket = os.Getenv(AWSREPORTBUCKET)
+	default:
+		return nil, fmt.Errorf("bucket must be %s or %s", BROWSESOURCE, BROWSEREPORT)
+	}
+	if bucket == "" {
+		return nil, fmt.Errorf("the %s bucket is not configured", browseRequest.Bucket)
+	}
+
+	max := int64(envInt(BROWSEMAXKEYS, 1000))
+	if browseRequest.MaxKeys < 0 || browseRequest.MaxKeys > max {
+		return nil, fmt.Errorf("maxKeys must be between 1 and %d", max)
+	}
+	if browseRequest.MaxKeys == 0 {
+		browseRequest.MaxKeys = 100
+	}
+	if browseRequest.To > 0 && browseRequest.From > browseRequest.To {
+		return nil, fmt.Errorf("from (%d) is after to (%d)", browseRequest.From, browseRequest.To)
+	}
+
+	input := &s3.ListObjectsV2Input{Bucket: aws.String(bucket), Prefix: aws.String(browseRequest.Prefix), MaxKeys: aws.Int64(browseRequest.MaxKeys)}
+	if browseRequest.Delimiter != "" {
+		input.Delimiter = aws.String(browseRequest.Delimiter)
+	}
+	if browseRequest.StartAfter != "" {
+		input.StartAfter = aws.String(browseRequest.StartAfter)
+	}
+	if browseRequest.ContinuationToken != "" {
+		input.ContinuationToken = aws.String(browseRequest.ContinuationToken)
+	}
+	return input, nil
+}
+
+// browseObjects - private function, filters the page by last modified time and flags the objects that have a document
+// s3 can't filter by date so a filtered page can have fewer objects than maxKeys (the next token is still valid)
+func browseObjects(con connectors.Clients, out *s3.ListObjectsV2Output, from int64, to int64) ([]schema.BrowseObject, error) {
+	objects := []schema.BrowseObject{}
+	var ids []string
+	for _, obj := range out.Contents {
+		modified := unixMillis(obj.LastModified)
+		if (from > 0 && modified < from) || (to > 0 && modified > to) {
+			continue
+		}
+		// keys that don't match a channel prefix have no report id (and can't have a document)
+		id, _, _ := reportId(aws.StringValue(obj.Key))
+		if id != "" {
+			ids = append(ids, id)
+		}
+		objects = append(objects, schema.BrowseObject{Key: aws.StringValue(obj.Key), Id: id, Size: aws.Int64Value(obj.Size), LastModified: modified})
+	}
+
+	existing, err := con.GetExisting(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range objects {
+		objects[i].Indexed = existing[objects[i].Id]
+	}
+	return objects, nil
+}
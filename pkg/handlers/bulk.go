@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/taxonomy"
+	gocb "github.com/couchbase/gocb/v2"
+)
+
+const (
+	BULKWORKERS  string = "BULK_WORKERS"
+	BULKMAXITEMS string = "BULK_MAX_ITEMS"
+)
+
+var (
+	errBulkMandatory = errors.New("id and cas (version token) are mandatory for updates")
+	errBulkDuplicate = errors.New("an id can only be updated once in an atomic request")
+)
+
+// BulkUpdateHandler - handler that reclassifies many reports in one call
+// items are applied concurrently (bounded by BULK_WORKERS) and a result is returned per item
+// with atomic set the items are applied all-or-nothing (in one couchbase transaction)
+func BulkUpdateHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	var bulkRequest *schema.BulkRequest
+	var results []schema.BulkResult
+	addHeaders(w, r)
+
+	// read the jwt token data in the body
+	// we don't use authorization header as the token can get quite large due to form data
+	// ensure we don't have nil - it will cause a null pointer exception
+	if r.Body == nil {
+		r.Body = ioutil.NopCloser(bytes.NewBufferString(""))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "BulkUpdateHandler body data error : %v"
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	con.TraceBody("BulkUpdateHandler request body : %s", body)
+
+	errs := json.Unmarshal(body, &bulkRequest)
+	if errs != nil {
+		msg := "BulkUpdateHandler could not unmarshal input data from servisBOT to schema %v"
+		con.Error(msg, errs)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, errs)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// check the jwt token
+	creds, err := verifyJwtToken(r.Context(), bulkRequest.JwtToken)
+	if err != nil {
+		msg := "BulkUpdateHandler verifyToken  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	max := envInt(BULKMAXITEMS, 500)
+	if len(bulkRequest.Items) == 0 || len(bulkRequest.Items) > max {
+		msg := "BulkUpdateHandler %v"
+		err = fmt.Errorf("items must contain between 1 and %d entries", max)
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusBadRequest, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	code, status := http.StatusOK, "OK"
+	if bulkRequest.Atomic {
+		results, code = bulkAtomic(con, creds, bulkRequest.Items)
+		if code != http.StatusOK {
+			status = "ERROR"
+		}
+	} else {
+		results = bulkConcurrent(con, creds, bulkRequest.Items, envInt(BULKWORKERS, 8))
+	}
+
+	response := &schema.BulkResponse{Code: code, Status: status, Message: fmt.Sprintf("BulkUpdateHandler processed %d items", len(results)), Results: results}
+	w.WriteHeader(code)
+	b, _ := json.MarshalIndent(response, "", "	")
+	fmt.Fprintf(w, string(b))
+	return
+}
+
+// bulkConcurrent - private function, applies each item independently with bounded parallelism (partial success allowed)
+func bulkConcurrent(con connectors.Clients, creds *schema.Credentials, items []schema.BulkItem, workers int) []schema.BulkResult {
+	var wg sync.WaitGroup
+	results := make([]schema.BulkResult, len(items))
+	sem := make(chan struct{}, workers)
+
+	for i := range items {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			current, err := bulkCheck(con, &items[i])
+			if err != nil {
+				results[i] = bulkError(items[i].Id, err)
+				return
+			}
+			results[i] = bulkApply(con, items[i], items[i].UserClassification, items[i].Cas)
+			if results[i].Code == http.StatusOK {
+				bulkAudit(con, creds, items[i], current, &results[i])
+			}
+		}(i)
+	}
+	wg.Wait()
+	return results
+}
+
+// bulkAtomic - private function, applies all items or none in one couchbase transaction
+// every item is checked (cas and label) before the transaction, in the transaction each document is compared with the
+// checked one so an update made in between aborts the batch (409 on that item), nothing is committed when any item fails
+// readers outside a transaction can see part of the batch while the commit is in progress
+func bulkAtomic(con connectors.Clients, creds *schema.Credentials, items []schema.BulkItem) ([]schema.BulkResult, int) {
+	results := make([]schema.BulkResult, len(items))
+	currents := make([]*schema.ReportList, len(items))
+	ids := make([]string, len(items))
+	index := make(map[string]int, len(items))
+
+	// phase 1 - validate every item before the transaction
+	code := http.StatusOK
+	for i := range items {
+		item := &items[i]
+		current, err := bulkCheck(con, item)
+		if err == nil && current.Cas != item.Cas {
+			err = gocb.ErrCasMismatch
+		}
+		if _, ok := index[item.Id]; err == nil && ok {
+			err = errBulkDuplicate
+		}
+		if err != nil {
+			results[i] = bulkError(item.Id, err)
+			if code == http.StatusOK {
+				code = results[i].Code
+			}
+			continue
+		}
+		currents[i], ids[i], index[item.Id] = current, item.Id, i
+		results[i] = schema.BulkResult{Id: item.Id, Code: http.StatusFailedDependency, Status: "NOT APPLIED", Message: "atomic update aborted"}
+	}
+	if code != http.StatusOK {
+		return results, code
+	}
+
+	// phase 2 - apply every item in one transaction
+	conflict := ""
+	err := con.UpdateReports(ids, func(id string, stats *schema.ListObject) error {
+		i := index[id]
+		if *stats != currents[i].ServisbotStats {
+			conflict = id
+			return fmt.Errorf("%s was updated after it was checked : %w", id, gocb.ErrCasMismatch)
+		}
+		stats.UserClassification = items[i].UserClassification
+		return nil
+	})
+	var ambiguous *gocb.TransactionCommitAmbiguousError
+	switch {
+	case errors.As(err, &ambiguous):
+		con.Error("Function bulkAtomic transaction commit ambiguous %v", err)
+		for i := range results {
+			results[i] = schema.BulkResult{Id: items[i].Id, Code: http.StatusInternalServerError, Status: "AMBIGUOUS", Message: fmt.Sprintf("the items may or may not have been applied (read the reports again) : %v", err)}
+		}
+		return results, http.StatusInternalServerError
+	case err != nil && conflict != "":
+		con.Error("Function bulkAtomic transaction conflict %v", err)
+		results[index[conflict]] = bulkError(conflict, err)
+		return results, http.StatusConflict
+	case err != nil:
+		con.Error("Function bulkAtomic transaction %v", err)
+		failed := bulkError("", err)
+		for i := range results {
+			results[i].Code, results[i].Message = failed.Code, failed.Message
+		}
+		return results, failed.Code
+	}
+
+	// the transaction result has no cas, it is read again for the next update
+	for i, item := range items {
+		results[i] = schema.BulkResult{Id: item.Id, Code: http.StatusOK, Status: "OK"}
+		if updated, err := con.GetReport(item.Id); err == nil {
+			results[i].Cas = updated.Cas
+		}
+		if !bulkAudit(con, creds, item, currents[i], &results[i]) {
+			code = http.StatusInternalServerError
+		}
+	}
+	return results, code
+}
+
+// bulkCheck - private function, validates the item and returns the current document
+// the user classification is normalized (in place) with the affiliate's label taxonomy
+func bulkCheck(con connectors.Clients, item *schema.BulkItem) (*schema.ReportList, error) {
+	if item.Id == "" || item.Cas == 0 {
+		return nil, errBulkMandatory
+	}
+	current, err := con.GetReport(item.Id)
+	if err != nil {
+		return nil, err
+	}
+	label, err := taxonomy.Get().Normalize(current.ServisbotStats.AffiliateId, item.UserClassification)
+	if err != nil {
+		return nil, err
+	}
+	item.UserClassification = label
+	return current, nil
+}
+
+// bulkApply - private function, sets the user classification for a single report (cas guarded)
+func bulkApply(con connectors.Clients, item schema.BulkItem, classification string, cas schema.Cas) schema.BulkResult {
+	specs := []gocb.MutateInSpec{gocb.UpsertSpec("UserClassification", classification, &gocb.UpsertSpecOptions{})}
+	res, err := con.MutateIn(item.Id, specs, &gocb.MutateInOptions{Cas: gocb.Cas(cas)})
+	if err != nil {
+		con.Error("Function bulkApply (mutatein) couchbase %s %v", item.Id, err)
+		return bulkError(item.Id, err)
+	}
+	return schema.BulkResult{Id: item.Id, Code: http.StatusOK, Status: "OK", Cas: schema.Cas(res.Cas())}
+}
+
+// bulkAudit - private function, writes the audit record (invalidates the cached report and writes it back) if the classification changed
+// the audit outcome is set on the (applied) item result, false is returned when the audit record was lost
+func bulkAudit(con connectors.Clients, creds *schema.Credentials, item schema.BulkItem, current *schema.ReportList, result *schema.BulkResult) bool {
+	if current.ServisbotStats.UserClassification == item.UserClassification {
+		return true
+	}
+	changes := map[string]string{"UserClassification": item.UserClassification}
+	err := writeAudit(con, creds, item.Id, current.ServisbotStats, changes)
+	invalidateReport(con, item.Id, current.ServisbotStats.Channel)
+	writeBack(con, creds, item.Id, current.ServisbotStats, changes)
+	switch {
+	case err == nil:
+	case errors.Is(err, errAuditDeferred):
+		result.Message = err.Error()
+	default:
+		result.Code, result.Status, result.Message = http.StatusInternalServerError, "AUDIT FAILED", fmt.Sprintf("the update was applied but %v", err)
+		return false
+	}
+	return true
+}
+
+// bulkError - private function, maps an error to the per item result
+func bulkError(id string, err error) schema.BulkResult {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, gocb.ErrCasMismatch):
+		code = http.StatusConflict
+	case errors.Is(err, gocb.ErrDocumentNotFound):
+		code = http.StatusNotFound
+	case errors.Is(err, errBulkMandatory), errors.Is(err, errBulkDuplicate), errors.Is(err, taxonomy.ErrUnknownLabel):
+		code = http.StatusBadRequest
+	}
+	return schema.BulkResult{Id: id, Code: code, Status: "ERROR", Message: err.Error()}
+}
+
+// envInt - private function, reads a positive integer envar (or returns the default)
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
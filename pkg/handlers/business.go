@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"os"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/taxonomy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	BUSINESSMETRICSINTERVAL string        = "BUSINESS_METRICS_INTERVAL"
+	DEFAULTBUSINESSINTERVAL time.Duration = 5 * time.Minute
+)
+
+var (
+	reportsStored = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "reports_stored",
+		Help: "Number of reports (servisbotstats documents).",
+	})
+	reportsUnreviewed = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "reports_unreviewed",
+		Help: "Number of reports not yet classified by a reviewer (the review backlog).",
+	})
+	classificationAccuracy = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "classification_accuracy_ratio",
+		Help: "Share of the reviewed reports of each bot outcome (class) that the reviewer agreed with.",
+	}, []string{"class"})
+	businessLastRefresh = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "business_metrics_last_refresh_timestamp_seconds",
+		Help: "Unix time the business gauges were last refreshed.",
+	})
+)
+
+// RefreshBusinessMetrics - sets the report, backlog and accuracy gauges from couchbase
+// each gauge is refreshed on its own so a failed query leaves only its gauge stale, the first error is returned
+func RefreshBusinessMetrics(con connectors.Clients) error {
+	var first error
+	failed := func(err error) bool {
+		if err != nil && first == nil {
+			first = err
+		}
+		return err != nil
+	}
+
+	total, err := con.GetListCount()
+	if !failed(err) {
+		reportsStored.Set(float64(*total))
+	}
+	unreviewed, err := con.GetUnreviewedCount()
+	if !failed(err) {
+		reportsUnreviewed.Set(float64(*unreviewed))
+	}
+	cm, err := con.GetConfusionMatrix()
+	if !failed(err) {
+		ratios := accuracy(cm)
+		for _, class := range taxonomy.Classes {
+			if ratio, ok := ratios[class]; ok {
+				classificationAccuracy.WithLabelValues(class).Set(ratio)
+			} else {
+				// no reviews (yet) is not an accuracy of 0
+				classificationAccuracy.DeleteLabelValues(class)
+			}
+		}
+	}
+	if first == nil {
+		businessLastRefresh.SetToCurrentTime()
+	}
+	return first
+}
+
+// accuracy - private function, the agreement ratio of each matrix row (classes without reviews are left out)
+func accuracy(cm *schema.ConfusionMatrix) map[string]float64 {
+	ratios := make(map[string]float64)
+	row := func(class string, agreed int64, noAction int64, cancel int64, cancelAR int64) {
+		if reviewed := noAction + cancel + cancelAR; reviewed > 0 {
+			ratios[class] = float64(agreed) / float64(reviewed)
+		}
+	}
+	row(taxonomy.NOACTION, cm.NoAction.NoAction, cm.NoAction.NoAction, cm.NoAction.Cancel, cm.NoAction.CancelAR)
+	row(taxonomy.CANCEL, cm.Cancel.Cancel, cm.Cancel.NoAction, cm.Cancel.Cancel, cm.Cancel.CancelAR)
+	row(taxonomy.CANCELAR, cm.CancelAR.CancelAR, cm.CancelAR.NoAction, cm.CancelAR.Cancel, cm.CancelAR.CancelAR)
+	return ratios
+}
+
+// BusinessMetricsJob - refreshes the business gauges now and then every BUSINESS_METRICS_INTERVAL (a go duration, default 5m)
+// until stop is closed, an interval of 0 disables the job
+func BusinessMetricsJob(con connectors.Clients, stop <-chan struct{}) {
+	interval := DEFAULTBUSINESSINTERVAL
+	if value := os.Getenv(BUSINESSMETRICSINTERVAL); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			con.Info("Business metrics job : disabled (%s is %s)", BUSINESSMETRICSINTERVAL, value)
+			return
+		}
+		interval = d
+	}
+	con.Info("Business metrics job : refreshing every %v", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := runJob(func() error { return RefreshBusinessMetrics(con) }); err != nil {
+			con.Error("Business metrics job : %v", err)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/taxonomy"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// TestBusinessMetrics - business gauges test entry point
+func TestBusinessMetrics(t *testing.T) {
+
+	logger := &logging.Logger{Level: "trace"}
+
+	t.Run("RefreshBusinessMetrics : should pass", func(t *testing.T) {
+		conn := NewTestConnectors(200, logger)
+		err := RefreshBusinessMetrics(conn)
+		if err != nil || testutil.ToFloat64(reportsStored) != 1234 || testutil.ToFloat64(reportsUnreviewed) != 1234 || testutil.ToFloat64(businessLastRefresh) == 0 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect gauges - got (%v %v %v) wanted (%d)", "RefreshBusinessMetrics", err, testutil.ToFloat64(reportsStored), testutil.ToFloat64(reportsUnreviewed), 1234))
+		}
+		// the fixture has no reviews so there is no accuracy
+		if testutil.CollectAndCount(classificationAccuracy) != 0 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect accuracy - got (%d) wanted (%d)", "RefreshBusinessMetrics", testutil.CollectAndCount(classificationAccuracy), 0))
+		}
+	})
+
+	t.Run("RefreshBusinessMetrics : should fail (forced error)", func(t *testing.T) {
+		conn := NewTestConnectors(200, logger)
+		conn.Meta("true")
+		if err := RefreshBusinessMetrics(conn); err == nil {
+			t.Errorf(fmt.Sprintf("Function %s did not return an error - got (%v) wanted (%s)", "RefreshBusinessMetrics", err, "error"))
+		}
+	})
+
+	t.Run("accuracy : should pass (agreement per bot outcome)", func(t *testing.T) {
+		cm := &schema.ConfusionMatrix{}
+		cm.NoAction.NoAction, cm.NoAction.Cancel = 3, 1
+		cm.Cancel.Cancel, cm.Cancel.CancelAR = 1, 1
+		ratios := accuracy(cm)
+		if len(ratios) != 2 || ratios[taxonomy.NOACTION] != 0.75 || ratios[taxonomy.CANCEL] != 0.5 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect ratios - got (%v) wanted (%s)", "accuracy", ratios, "0.75 0.5 (no cancel autorenewal reviews)"))
+		}
+	})
+
+	t.Run("runJob : should fail (panic returned as an error)", func(t *testing.T) {
+		err := runJob(func() error {
+			var rl *schema.ReportList
+			return fmt.Errorf("%s", rl.Id)
+		})
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s did not recover - got (%v) wanted (%s)", "runJob", err, "error"))
+		}
+	})
+
+	t.Run("BusinessMetricsJob : should pass (disabled with a zero interval)", func(t *testing.T) {
+		os.Setenv(BUSINESSMETRICSINTERVAL, "0")
+		defer os.Unsetenv(BUSINESSMETRICSINTERVAL)
+		// returns immediately
+		BusinessMetricsJob(NewTestConnectors(200, logger), make(chan struct{}))
+	})
+
+	t.Run("BusinessMetricsJob : should pass (runs until stopped)", func(t *testing.T) {
+		os.Setenv(BUSINESSMETRICSINTERVAL, "10ms")
+		defer os.Unsetenv(BUSINESSMETRICSINTERVAL)
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			BusinessMetricsJob(NewTestConnectors(200, logger), stop)
+			close(done)
+		}()
+		time.Sleep(30 * time.Millisecond)
+		close(stop)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf(fmt.Sprintf("Function %s did not stop", "BusinessMetricsJob"))
+		}
+	})
+}
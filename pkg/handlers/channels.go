@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+)
+
+// default channel to s3 object key prefix map
+// override with CHANNEL_PREFIXES i.e "Email=Email/,WebForm=Form/,Chat=Chat/"
+var defaultChannelPrefixes = map[string]string{
+	schema.CHANNELEMAIL:   "Email/",
+	schema.CHANNELWEBFORM: "WebForm/",
+	schema.CHANNELCHAT:    "Chat/",
+}
+
+// channelPrefixes - private function, returns the configured channel to prefix map
+func channelPrefixes() map[string]string {
+	env := os.Getenv(CHANNELPREFIXES)
+	if env == "" {
+		return defaultChannelPrefixes
+	}
+	prefixes := make(map[string]string)
+	for _, item := range strings.Split(env, ",") {
+		kv := strings.SplitN(strings.TrimSpace(item), "=", 2)
+		if len(kv) == 2 && kv[0] != "" {
+			prefixes[kv[0]] = kv[1]
+		}
+	}
+	return prefixes
+}
+
+// channelPrefix - private function, returns the s3 object key prefix for the report channel
+// reports without a channel were all emails (before other channels were supported)
+func channelPrefix(channel string) (string, error) {
+	if channel == "" {
+		channel = EMAIL
+	}
+	for name, prefix := range channelPrefixes() {
+		if strings.EqualFold(name, channel) {
+			return prefix, nil
+		}
+	}
+	return "", fmt.Errorf("channel %s has no configured object prefix", channel)
+}
@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/email"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/redact"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gorilla/mux"
+)
+
+const (
+	AWSEMAILPREFIX string = "AWS_EMAIL_PREFIX"
+)
+
+// EmailHandler - handler that returns a structured view of the original (raw mime) email for a report
+func EmailHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	var servisbotRequest *schema.ServisBOTRequest
+	addHeaders(w, r)
+
+	// read the jwt token data in the body
+	// we don't use authorization header as the token can get quite large due to form data
+	// ensure we don't have nil - it will cause a null pointer exception
+	if r.Body == nil {
+		r.Body = ioutil.NopCloser(bytes.NewBufferString(""))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "EmailHandler body data %v"
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	con.TraceBody("EmailHandler request body : %s", body)
+
+	errs := json.Unmarshal(body, &servisbotRequest)
+	if errs != nil {
+		msg := "EmailHandler could not unmarshal input data from servisBOT to schema %v"
+		con.Error(msg, errs)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, errs)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// check the jwt token
+	creds, err := verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
+	if err != nil {
+		msg := "EmailHandler verifyToken  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	unmasked, code, err := checkUnmask(con, creds, servisbotRequest, "Email")
+	if err != nil {
+		msg := "EmailHandler unmask %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	raw, code, err := rawEmail(con, servisbotRequest)
+	if err != nil {
+		msg := "EmailHandler %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	view, err := email.Parse(raw)
+	if err != nil {
+		msg := "EmailHandler (parse) %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusUnprocessableEntity, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	if !unmasked {
+		view = redact.Get().Email(creds.Role, view)
+	}
+
+	response := &schema.EmailResponse{Code: http.StatusOK, Status: "OK", Message: "EmailHandler s3 object call successful", Email: view}
+	w.WriteHeader(http.StatusOK)
+	b, _ := json.MarshalIndent(response, "", "	")
+	fmt.Fprintf(w, string(b))
+	return
+}
+
+// EmailAttachmentHandler - handler that downloads a single attachment (by index) of the original email
+func EmailAttachmentHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	var servisbotRequest *schema.ServisBOTRequest
+	vars := mux.Vars(r)
+	addHeaders(w, r)
+
+	// read the jwt token data in the body
+	// we don't use authorization header as the token can get quite large due to form data
+	// ensure we don't have nil - it will cause a null pointer exception
+	if r.Body == nil {
+		r.Body = ioutil.NopCloser(bytes.NewBufferString(""))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "EmailAttachmentHandler body data %v"
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	con.TraceBody("EmailAttachmentHandler request body : %s", body)
+
+	errs := json.Unmarshal(body, &servisbotRequest)
+	if errs != nil {
+		msg := "EmailAttachmentHandler could not unmarshal input data from servisBOT to schema %v"
+		con.Error(msg, errs)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, errs)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// check the jwt token
+	creds, err := verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
+	if err != nil {
+		msg := "EmailAttachmentHandler verifyToken  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// attachments can't be redacted so only roles that can unmask may download them
+	if !redact.Get().CanUnmask(creds.Role) {
+		msg := "EmailAttachmentHandler %v"
+		con.Error(msg, redact.ErrUnmaskDenied)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, redact.ErrUnmaskDenied)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	index, err := strconv.Atoi(vars["index"])
+	if err != nil {
+		msg := "EmailAttachmentHandler index %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusBadRequest, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	raw, code, err := rawEmail(con, servisbotRequest)
+	if err != nil {
+		msg := "EmailAttachmentHandler %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	attachment, err := email.GetAttachment(raw, index)
+	if err != nil {
+		code := http.StatusUnprocessableEntity
+		if errors.Is(err, email.ErrAttachmentNotFound) {
+			code = http.StatusNotFound
+		}
+		msg := "EmailAttachmentHandler %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// the attachment is only returned when its download is audited
+	err = insertAudit(con, creds, ATTACHMENT, servisbotRequest.Data.Id, fmt.Sprintf("Attachment[%d]", index), "", attachment.Filename)
+	if err != nil {
+		msg := "EmailAttachmentHandler (audit) %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// the attachment is returned as is (not json), always as a download
+	w.Header().Set(CONTENTTYPE, attachment.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", attachment.Filename))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	w.Write(attachment.Data)
+	return
+}
+
+// rawEmail - private function, gets the original (raw mime) email using the report's EmailS3Key
+func rawEmail(con connectors.Clients, servisbotRequest *schema.ServisBOTRequest) ([]byte, int, error) {
+	report, _, code, err := reportContent(con, servisbotRequest)
+	if err != nil {
+		return nil, code, err
+	}
+	if report.EmailS3Key == "" {
+		return nil, http.StatusNotFound, errors.New("report has no original email (EmailS3Key is empty)")
+	}
+
+	bucket := os.Getenv(AWSBUCKET)
+	key := os.Getenv(AWSEMAILPREFIX) + report.EmailS3Key
+	raw, err := con.GetRawObject(&s3.GetObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return raw, http.StatusOK, nil
+}
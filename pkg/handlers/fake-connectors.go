@@ -1,16 +1,23 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
 
 	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/redact"
 	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/s3"
 	gocb "github.com/couchbase/gocb/v2"
-	"github.com/microlib/simple"
 )
 
 // Fake connectors used in this package for testing only
@@ -23,10 +30,16 @@ type FakeS3 struct {
 
 // Fake all connections
 type FakeConnectors struct {
-	S3Service *FakeS3
-	Logger    *simple.Logger
-	Flag      string
-	Mode      string
+	S3Service   *FakeS3
+	Logger      *logging.Logger
+	Flag        string
+	Mode        string
+	Invalidated []string
+	Written     []string
+	Puts        int
+	Cas         gocb.Cas
+	Replaced    *schema.ListObject
+	mu          sync.Mutex
 }
 
 // Error - log wrapper
@@ -49,12 +62,22 @@ func (c *FakeConnectors) Trace(msg string, val ...interface{}) {
 	c.Logger.Trace(fmt.Sprintf(msg, val...))
 }
 
+// TraceBody - log wrapper (masked as in the real implementation)
+func (c *FakeConnectors) TraceBody(msg string, body []byte) {
+	c.Logger.Trace(fmt.Sprintf(msg, redact.Body(body)))
+}
+
 // Meta - log wrapper
 func (c *FakeConnectors) Meta(flag string) string {
 	c.Flag = flag
 	return flag
 }
 
+// WithContext - the same connectors (the recorded calls are shared by all requests)
+func (c *FakeConnectors) WithContext(ctx context.Context) connectors.Clients {
+	return c
+}
+
 // Upsert : wrapper function for couchbase update
 func (c *FakeConnectors) Upsert(uuid string, value interface{}, opts *gocb.UpsertOptions) (*gocb.MutationResult, error) {
 	if c.Flag == "true" {
@@ -63,6 +86,140 @@ func (c *FakeConnectors) Upsert(uuid string, value interface{}, opts *gocb.Upser
 	return &gocb.MutationResult{}, nil
 }
 
+// Replace : wrapper function for couchbase replace
+func (c *FakeConnectors) Replace(uuid string, value interface{}, opts *gocb.ReplaceOptions) (*gocb.MutationResult, error) {
+	if c.Flag == "true" {
+		return &gocb.MutationResult{}, errors.New("Replace (forced error)")
+	}
+	if c.Flag == "cas" {
+		return &gocb.MutationResult{}, gocb.ErrCasMismatch
+	}
+	if lo, ok := value.(schema.ListObject); ok {
+		c.Replaced = &lo
+	}
+	c.lastCas(opts.Cas)
+	return &gocb.MutationResult{}, nil
+}
+
+// Insert : wrapper function for couchbase insert
+func (c *FakeConnectors) Insert(bucket string, uuid string, value interface{}, opts *gocb.InsertOptions) (*gocb.MutationResult, error) {
+	if c.Flag == "true" || c.Flag == "insert" || (c.Flag == "audit" && bucket == AUDITBUCKET) {
+		return &gocb.MutationResult{}, errors.New("Insert (forced error)")
+	}
+	if c.Flag == "exists" {
+		return &gocb.MutationResult{}, gocb.ErrDocumentExists
+	}
+	return &gocb.MutationResult{}, nil
+}
+
+// GetIds - Couchbase id list wrapper (the second id has no s3 object)
+func (c *FakeConnectors) GetIds() ([]string, error) {
+	if c.Flag == "true" || c.Flag == "ids" {
+		return nil, errors.New("forced GetIds (DB) error")
+	}
+	return []string{"096esbpfrk8b3nhdlfhditsmk10gj03g06i3c201.json", "0orphan0000000000000000000000000000000001.json"}, nil
+}
+
+// GetExisting - Couchbase keyed lookup wrapper (only the ids returned by GetIds have a document)
+func (c *FakeConnectors) GetExisting(ids []string) (map[string]bool, error) {
+	existing := make(map[string]bool)
+	if c.Flag == "true" || c.Flag == "existing" {
+		return existing, errors.New("forced GetExisting (DB) error")
+	}
+	all, _ := c.GetIds()
+	for _, id := range ids {
+		for _, known := range all {
+			if id == known {
+				existing[id] = true
+			}
+		}
+	}
+	return existing, nil
+}
+
+// Remove : wrapper function for couchbase remove
+func (c *FakeConnectors) Remove(uuid string, opts *gocb.RemoveOptions) (*gocb.MutationResult, error) {
+	if c.Flag == "true" || c.Flag == "remove" {
+		return &gocb.MutationResult{}, errors.New("Remove (forced error)")
+	}
+	return &gocb.MutationResult{}, nil
+}
+
+// GetAuditList - Couchbase audit list wrapper
+func (c *FakeConnectors) GetAuditList(field string, value string, offset string, limit string) ([]schema.AuditRecord, error) {
+	var list []schema.AuditRecord
+	if c.Flag == "true" {
+		return list, errors.New("forced GetAuditList (DB) error")
+	}
+	b, _ := ioutil.ReadFile("../../tests/payload-audit.json")
+	c.Trace("GetAuditList mock response %s", string(b))
+	json.Unmarshal(b, &list)
+	return list, nil
+}
+
+// MutateIn : wrapper function for couchbase sub-document mutations
+func (c *FakeConnectors) MutateIn(uuid string, specs []gocb.MutateInSpec, opts *gocb.MutateInOptions) (*gocb.MutateInResult, error) {
+	if c.Flag == "true" {
+		return &gocb.MutateInResult{}, errors.New("MutateIn (forced error)")
+	}
+	if c.Flag == "cas" {
+		return &gocb.MutateInResult{}, gocb.ErrCasMismatch
+	}
+	c.lastCas(opts.Cas)
+	return &gocb.MutateInResult{}, nil
+}
+
+// UpdateReports - simulates the transaction (with the cas flag the documents were changed after they were checked)
+func (c *FakeConnectors) UpdateReports(ids []string, update func(id string, current *schema.ListObject) error) error {
+	if c.Flag == "txn" {
+		return errors.New("UpdateReports (forced error)")
+	}
+	if c.Flag == "ambiguous" {
+		return &gocb.TransactionCommitAmbiguousError{}
+	}
+	for _, id := range ids {
+		current, err := c.GetReport(id)
+		if err != nil {
+			return err
+		}
+		if c.Flag == "cas" {
+			current.ServisbotStats.UserClassification = "Concurrent Update"
+		}
+		if err = update(id, &current.ServisbotStats); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lastCas - keeps the cas of the last mutation (the tests check it is not rounded)
+func (c *FakeConnectors) lastCas(cas gocb.Cas) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Cas = cas
+}
+
+// GetReport - Couchbase get wrapper
+func (c *FakeConnectors) GetReport(id string) (*schema.ReportList, error) {
+	var list []schema.ReportList
+	if c.Flag == "true" {
+		return nil, errors.New("forced GetReport (DB) error")
+	}
+	b, _ := ioutil.ReadFile("../../tests/payload-reportlist-01.json")
+	json.Unmarshal(b, &list)
+	list[0].Id = id
+	list[0].Cas = 1700000000000000123
+	// documents projected before the email key was added
+	if c.Flag == "projection" {
+		list[0].ServisbotStats.EmailS3Key = ""
+	}
+	// reviewer notes written with a patch
+	if c.Flag == "notes" {
+		list[0].ServisbotStats.ReviewerNotes = "customer called back"
+	}
+	return &list[0], nil
+}
+
 // GetList - Couchbase list wrapper
 func (c *FakeConnectors) GetList(offset string, limit string) ([]schema.ReportList, error) {
 	var list []schema.ReportList
@@ -98,19 +255,131 @@ func (c *FakeConnectors) GetListCount() (*int64, error) {
 	return &val, nil
 }
 
+// GetUnreviewedCount - Couchbase unreviewed count wrapper
+func (c *FakeConnectors) GetUnreviewedCount() (*int64, error) {
+	if c.Flag == "true" {
+		val := int64(0)
+		return &val, errors.New("forced GetUnreviewedCount (DB) error")
+	}
+	c.Trace("GetUnreviewedCount 1234")
+	val := int64(1234)
+	return &val, nil
+}
+
 // GetObject - S3 Object download wrapper
 func (c *FakeConnectors) GetObject(opts *s3.GetObjectInput) (*schema.ReportContent, error) {
 	var rc *schema.ReportContent
 	if c.Flag == "true" {
 		return rc, errors.New("forced s3 ListObjectsV2 error")
 	}
+	if c.Flag == "nosuchkey" || strings.HasSuffix(*opts.Key, "missing") {
+		return rc, awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil)
+	}
+	if aws.StringValue(opts.VersionId) == "missing" {
+		return rc, awserr.New("NoSuchVersion", "The specified version does not exist.", nil)
+	}
 	b, _ := ioutil.ReadFile("../../tests/report-payload.json")
 	json.Unmarshal(b, &rc)
+	// the previous version has a different bot result
+	if aws.StringValue(opts.VersionId) == "v1" {
+		rc.ProcessOutcome = "Cancel"
+		rc.Entities = []string{"test"}
+	}
 	return rc, nil
 }
 
+// InvalidateObject - records the invalidated object keys
+func (c *FakeConnectors) InvalidateObject(opts *s3.GetObjectInput) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Invalidated = append(c.Invalidated, *opts.Key)
+}
+
+// PutObject - records the written object keys (the put flag fails every attempt, the retry flag fails the first)
+func (c *FakeConnectors) PutObject(opts *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Puts++
+	if c.Flag == "true" || c.Flag == "put" || (c.Flag == "retry" && c.Puts == 1) {
+		return &s3.PutObjectOutput{}, errors.New("forced s3 PutObject error")
+	}
+	c.Written = append(c.Written, *opts.Key)
+	return &s3.PutObjectOutput{VersionId: aws.String("v3")}, nil
+}
+
+// GetRawObject - S3 Object download wrapper
+func (c *FakeConnectors) GetRawObject(opts *s3.GetObjectInput) ([]byte, error) {
+	if c.Flag == "true" || c.Flag == "raw" {
+		return nil, errors.New("forced s3 GetObject (raw) error")
+	}
+	return ioutil.ReadFile("../../tests/email-multipart.eml")
+}
+
+// ListObjects - S3 list wrapper (only the email prefix has objects, returned as two pages, StartAfter skips the first page)
+// the root listing with a delimiter returns the channel prefixes
+func (c *FakeConnectors) ListObjects(opts *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	if c.Flag == "true" || c.Flag == "list" {
+		return &s3.ListObjectsV2Output{}, errors.New("forced s3 ListObjectsV2 error")
+	}
+	if aws.StringValue(opts.Prefix) == "" && aws.StringValue(opts.Delimiter) == "/" {
+		return &s3.ListObjectsV2Output{CommonPrefixes: []*s3.CommonPrefix{{Prefix: aws.String("Chat/")}, {Prefix: aws.String("Email/")}}, IsTruncated: aws.Bool(false)}, nil
+	}
+	if *opts.Prefix != "Email/" {
+		return &s3.ListObjectsV2Output{IsTruncated: aws.Bool(false)}, nil
+	}
+	first := "Email/096esbpfrk8b3nhdlfhditsmk10gj03g06i3c201.json"
+	modified := time.Unix(1597144108, 0)
+	if opts.ContinuationToken == nil && (opts.StartAfter == nil || *opts.StartAfter < first) {
+		return &s3.ListObjectsV2Output{
+			Contents:              []*s3.Object{{Key: aws.String(first), Size: aws.Int64(1024), LastModified: aws.Time(modified)}},
+			IsTruncated:           aws.Bool(true),
+			NextContinuationToken: aws.String("page2"),
+		}, nil
+	}
+	return &s3.ListObjectsV2Output{
+		Contents:    []*s3.Object{{Key: aws.String("Email/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1"), Size: aws.Int64(2048), LastModified: aws.Time(modified.Add(time.Hour))}},
+		IsTruncated: aws.Bool(false),
+	}, nil
+}
+
+// HeadObject - S3 object metadata wrapper (only the orphan document has no object, with the head flag every object exists)
+func (c *FakeConnectors) HeadObject(opts *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	if c.Flag == "true" {
+		return &s3.HeadObjectOutput{}, errors.New("forced s3 HeadObject error")
+	}
+	if c.Flag != "head" && strings.Contains(*opts.Key, "0orphan") {
+		return &s3.HeadObjectOutput{}, awserr.New("NotFound", "Not Found", nil)
+	}
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(1024)}, nil
+}
+
+// ListObjectVersions - S3 version list wrapper (two versions and a delete marker of the key, the other key must be filtered out)
+func (c *FakeConnectors) ListObjectVersions(opts *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	if c.Flag == "true" || c.Flag == "versions" {
+		return &s3.ListObjectVersionsOutput{}, errors.New("forced s3 ListObjectVersions error")
+	}
+	modified := time.Unix(1597144108, 0)
+	return &s3.ListObjectVersionsOutput{
+		Versions: []*s3.ObjectVersion{
+			{Key: opts.Prefix, VersionId: aws.String("v2"), IsLatest: aws.Bool(true), Size: aws.Int64(2048), LastModified: aws.Time(modified.Add(time.Hour))},
+			{Key: aws.String(*opts.Prefix + "_copy"), VersionId: aws.String("c1"), IsLatest: aws.Bool(true), Size: aws.Int64(2048), LastModified: aws.Time(modified)},
+			{Key: opts.Prefix, VersionId: aws.String("v1"), IsLatest: aws.Bool(false), Size: aws.Int64(1024), LastModified: aws.Time(modified)},
+		},
+		DeleteMarkers: []*s3.DeleteMarkerEntry{{Key: opts.Prefix, VersionId: aws.String("d1"), IsLatest: aws.Bool(false), LastModified: aws.Time(modified.Add(time.Minute))}},
+		IsTruncated:   aws.Bool(false),
+	}, nil
+}
+
+// PresignGetObject - S3 presign wrapper
+func (c *FakeConnectors) PresignGetObject(opts *s3.GetObjectInput, expiry time.Duration) (string, error) {
+	if c.Flag == "true" || c.Flag == "presign" {
+		return "", errors.New("forced s3 presign error")
+	}
+	return fmt.Sprintf("https://%s.s3.amazonaws.com/%s?X-Amz-Expires=%d", *opts.Bucket, *opts.Key, int64(expiry.Seconds())), nil
+}
+
 // NewTestConnector - creates all test connectors
-func NewTestConnectors(code int, logger *simple.Logger) connectors.Clients {
+func NewTestConnectors(code int, logger *logging.Logger) connectors.Clients {
 	conns := &FakeConnectors{Logger: logger, Flag: "false"}
 	return conns
 }
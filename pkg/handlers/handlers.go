@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -10,7 +11,10 @@ import (
 	"os"
 
 	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/redact"
 	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/taxonomy"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/tracing"
 	"github.com/aws/aws-sdk-go/service/s3"
 	gocb "github.com/couchbase/gocb/v2"
 	"github.com/dgrijalva/jwt-go"
@@ -23,10 +27,30 @@ const (
 	HANDLERESPONSE  string = "Function handleResponse "
 	AWSBUCKET       string = "AWS_BUCKET"
 	AWSREPORTBUCKET string = "AWS_REPORT_BUCKET"
-	CHANNEL         string = "Email/"
+	CHANNELPREFIXES string = "CHANNEL_PREFIXES"
 	EMAIL           string = "Email"
 )
 
+// reviewer owned fields - the only fields that can be changed via a partial (PATCH) update
+var reviewerFields = map[string]bool{
+	"UserClassification": true,
+	"ReviewerNotes":      true,
+}
+
+// bot owned fields - these are set by the bot when the report is created and are read only
+var botFields = map[string]bool{
+	"ProcessOutcome":      true,
+	"EmailClassification": true,
+	"Success":             true,
+	"Timestamp":           true,
+	"AffiliateId":         true,
+	"Channel":             true,
+	"Subject":             true,
+	"Sender":              true,
+	"CustomerNumber":      true,
+	"Preview":             true,
+}
+
 // ListHandler - handler that returns servisBOT accuracy
 func ListHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
 	var servisbotRequest *schema.ServisBOTRequest
@@ -47,7 +71,7 @@ func ListHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients)
 		return
 	}
 
-	con.Trace("ListHandler request body : %s", string(body))
+	con.TraceBody("ListHandler request body : %s", body)
 
 	errs := json.Unmarshal(body, &servisbotRequest)
 	if errs != nil {
@@ -59,7 +83,7 @@ func ListHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients)
 	}
 
 	// check the jwt token
-	_, err = verifyJwtToken(servisbotRequest.JwtToken)
+	creds, err := verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
 	if err != nil {
 		msg := "ListHandler verifyToken  %v"
 		con.Error(msg, err)
@@ -78,6 +102,10 @@ func ListHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients)
 		return
 	}
 
+	for i := range res {
+		res[i].ServisbotStats = redact.Get().List(creds.Role, res[i].ServisbotStats)
+	}
+
 	response := &schema.Response{Code: http.StatusOK, Status: "OK", Message: "ListHandler retrieved data successfully ", Reports: res}
 	w.WriteHeader(http.StatusOK)
 	b, _ := json.MarshalIndent(response, "", "	")
@@ -104,7 +132,7 @@ func ReportUpdateHandler(w http.ResponseWriter, r *http.Request, con connectors.
 		return
 	}
 
-	con.Trace(" ReportUpdateHandler request body : %s", string(body))
+	con.TraceBody(" ReportUpdateHandler request body : %s", body)
 
 	errs := json.Unmarshal(body, &servisbotRequest)
 	if errs != nil {
@@ -116,7 +144,7 @@ func ReportUpdateHandler(w http.ResponseWriter, r *http.Request, con connectors.
 	}
 
 	// check the jwt token
-	_, err = verifyJwtToken(servisbotRequest.JwtToken)
+	creds, err := verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
 	if err != nil {
 		msg := "ReportUpdateHandler verifyToken  %v"
 		con.Error(msg, err)
@@ -125,18 +153,169 @@ func ReportUpdateHandler(w http.ResponseWriter, r *http.Request, con connectors.
 		return
 	}
 
+	// the cas (version token) from the list or detail response is mandatory
+	// this ensures concurrent reviewers don't silently overwrite each other
+	if servisbotRequest.Data.Cas == 0 {
+		msg := "ReportUpdateHandler %v"
+		err = errors.New("cas (version token) is mandatory for updates")
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusBadRequest, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// get the current document, the old values are needed for the audit trail
+	current, err := con.GetReport(servisbotRequest.Data.Id)
+	if err != nil {
+		b := responseGetReportError(w, "ReportUpdateHandler", err, con)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// labels must be part of the taxonomy, aliases are stored as the canonical label
+	label, err := taxonomy.Get().Normalize(current.ServisbotStats.AffiliateId, servisbotRequest.Data.ServisbotStats.UserClassification)
+	if err != nil {
+		msg := "ReportUpdateHandler %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusBadRequest, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+	// only the classification is taken from the request, the bot owned fields are read only
+	// (list rows can also be redacted so they must never be written back as is)
+	// the reviewer notes are only changed with a patch (clients that don't send them must not clear them)
+	update := current.ServisbotStats
+	update.UserClassification = label
+
 	// update the database
-	res, err := con.Upsert(servisbotRequest.Data.Id, servisbotRequest.Data.ServisbotStats, &gocb.UpsertOptions{})
+	res, err := con.Replace(servisbotRequest.Data.Id, update, &gocb.ReplaceOptions{Cas: gocb.Cas(servisbotRequest.Data.Cas)})
 	if err != nil {
+		if errors.Is(err, gocb.ErrCasMismatch) {
+			b := responseConflictFormat(w, "ReportUpdateHandler", servisbotRequest.Data.Id, creds, con)
+			fmt.Fprintf(w, string(b))
+			return
+		}
+		code := http.StatusInternalServerError
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			code = http.StatusNotFound
+		}
 		msg := "ReportUpdateHandler (post) couchbase  %v"
 		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	changes := changedFields(current.ServisbotStats, update)
+	err = writeAudit(con, creds, servisbotRequest.Data.Id, current.ServisbotStats, changes)
+	invalidateReport(con, servisbotRequest.Data.Id, current.ServisbotStats.Channel)
+	writeBack(con, creds, servisbotRequest.Data.Id, current.ServisbotStats, changes)
+
+	response := auditResponse("ReportUpdateHandler", "ReportUpdateHandler posted data successfully", schema.Cas(res.Cas()), err)
+	w.WriteHeader(response.Code)
+	b, _ := json.MarshalIndent(response, "", "	")
+	fmt.Fprintf(w, string(b))
+	return
+}
+
+// ReportPatchHandler - handler that updates only the reviewer owned fields of a report
+func ReportPatchHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	var servisbotRequest *schema.ServisBOTRequest
+	vars := mux.Vars(r)
+	addHeaders(w, r)
+
+	// read the jwt token data in the body
+	// we don't use authorization header as the token can get quite large due to form data
+	// ensure we don't have nil - it will cause a null pointer exception
+	if r.Body == nil {
+		r.Body = ioutil.NopCloser(bytes.NewBufferString(""))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "ReportPatchHandler body data error : %v"
 		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
 		fmt.Fprintf(w, string(b))
 		return
 	}
 
-	response := &schema.Response{Code: http.StatusOK, Status: "OK", Message: fmt.Sprintf("ReportUpdateHandler posted data successfully %v", res)}
-	w.WriteHeader(http.StatusOK)
+	con.TraceBody("ReportPatchHandler request body : %s", body)
+
+	errs := json.Unmarshal(body, &servisbotRequest)
+	if errs != nil {
+		msg := "ReportPatchHandler could not unmarshal input data from servisBOT to schema %v"
+		con.Error(msg, errs)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, errs)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// check the jwt token
+	creds, err := verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
+	if err != nil {
+		msg := "ReportPatchHandler verifyToken  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	if servisbotRequest.Data.Cas == 0 {
+		msg := "ReportPatchHandler %v"
+		err = errors.New("cas (version token) is mandatory for updates")
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusBadRequest, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// get the current document, the old values are needed for the audit trail
+	current, err := con.GetReport(vars["id"])
+	if err != nil {
+		b := responseGetReportError(w, "ReportPatchHandler", err, con)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	specs, code, err := patchSpecs(servisbotRequest.Patch, current.ServisbotStats.AffiliateId)
+	if err != nil {
+		msg := "ReportPatchHandler %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// update only the whitelisted paths in the document
+	res, err := con.MutateIn(vars["id"], specs, &gocb.MutateInOptions{Cas: gocb.Cas(servisbotRequest.Data.Cas)})
+	if err != nil {
+		if errors.Is(err, gocb.ErrCasMismatch) {
+			b := responseConflictFormat(w, "ReportPatchHandler", vars["id"], creds, con)
+			fmt.Fprintf(w, string(b))
+			return
+		}
+		code := http.StatusInternalServerError
+		if errors.Is(err, gocb.ErrDocumentNotFound) {
+			code = http.StatusNotFound
+		}
+		msg := "ReportPatchHandler (patch) couchbase  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	changes := make(map[string]string)
+	for field, value := range servisbotRequest.Patch {
+		if value.(string) != fieldValue(current.ServisbotStats, field) {
+			changes[field] = value.(string)
+		}
+	}
+	err = writeAudit(con, creds, vars["id"], current.ServisbotStats, changes)
+	invalidateReport(con, vars["id"], current.ServisbotStats.Channel)
+	writeBack(con, creds, vars["id"], current.ServisbotStats, changes)
+
+	response := auditResponse("ReportPatchHandler", "ReportPatchHandler patched data successfully", schema.Cas(res.Cas()), err)
+	w.WriteHeader(response.Code)
 	b, _ := json.MarshalIndent(response, "", "	")
 	fmt.Fprintf(w, string(b))
 	return
@@ -161,7 +340,7 @@ func ReportCountHandler(w http.ResponseWriter, r *http.Request, con connectors.C
 		return
 	}
 
-	con.Trace("ReportCountHandler request body : %s", string(body))
+	con.TraceBody("ReportCountHandler request body : %s", body)
 
 	errs := json.Unmarshal(body, &servisbotRequest)
 	if errs != nil {
@@ -173,7 +352,7 @@ func ReportCountHandler(w http.ResponseWriter, r *http.Request, con connectors.C
 	}
 
 	// check the jwt token
-	_, err = verifyJwtToken(servisbotRequest.JwtToken)
+	_, err = verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
 	if err != nil {
 		msg := "ReportCountHandler verifyToken  %v"
 		con.Error(msg, err)
@@ -218,7 +397,7 @@ func StatsHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients
 		return
 	}
 
-	con.Trace("StatsHandler request body : %s", string(body))
+	con.TraceBody("StatsHandler request body : %s", body)
 
 	errs := json.Unmarshal(body, &servisbotRequest)
 	if errs != nil {
@@ -230,7 +409,7 @@ func StatsHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients
 	}
 
 	// check the jwt token
-	_, err = verifyJwtToken(servisbotRequest.JwtToken)
+	_, err = verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
 	if err != nil {
 		msg := "StatsHandler verifyToken  %v"
 		con.Error(msg, err)
@@ -259,8 +438,6 @@ func StatsHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients
 // ReportObjectHandler - handler that interfaces with s3 bucket
 func ReportObjectHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
 	var servisbotRequest *schema.ServisBOTRequest
-
-	bucket := os.Getenv(AWSBUCKET)
 	addHeaders(w, r)
 
 	// read the jwt token data in the body
@@ -277,7 +454,7 @@ func ReportObjectHandler(w http.ResponseWriter, r *http.Request, con connectors.
 		return
 	}
 
-	con.Trace("ReportObjectHandler request body : %s", string(body))
+	con.TraceBody("ReportObjectHandler request body : %s", body)
 
 	// unmarshal result from mw backend
 	errs := json.Unmarshal(body, &servisbotRequest)
@@ -290,7 +467,7 @@ func ReportObjectHandler(w http.ResponseWriter, r *http.Request, con connectors.
 	}
 
 	// check the jwt token
-	_, err = verifyJwtToken(servisbotRequest.JwtToken)
+	creds, err := verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
 	if err != nil {
 		msg := "ReportObjectHandler verifyToken  %v"
 		con.Error(msg, err)
@@ -299,25 +476,100 @@ func ReportObjectHandler(w http.ResponseWriter, r *http.Request, con connectors.
 		return
 	}
 
-	key := "Email/" + servisbotRequest.Data.Id
-	opts := &s3.GetObjectInput{Bucket: &bucket, Key: &key}
-	data, e := con.GetObject(opts)
-	if e != nil {
+	unmasked, code, err := checkUnmask(con, creds, servisbotRequest, "ReportContent")
+	if err != nil {
+		msg := "ReportObjectHandler unmask %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	data, cas, code, err := reportContent(con, servisbotRequest)
+	if err != nil {
 		msg := "ReportObjectHandler %v"
-		con.Error(msg, e)
-		b := responseErrorFormat(http.StatusInternalServerError, w, msg, errs)
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
 		fmt.Fprintf(w, string(b))
 		return
 	}
 
+	if !unmasked {
+		data = redact.Get().Report(creds.Role, data)
+	}
+
 	con.Trace("ReportObjectHandler data %v", data)
-	response := &schema.ReportResponse{Code: http.StatusOK, Status: "OK", Message: "ReportObjectHandler s3 object call successful", Report: *data}
+	response := &schema.ReportResponse{Code: http.StatusOK, Status: "OK", Message: "ReportObjectHandler s3 object call successful", Cas: cas, Report: *data}
 	w.WriteHeader(http.StatusOK)
 	b, _ := json.MarshalIndent(response, "", "	")
 	fmt.Fprintf(w, string(b))
 	return
 }
 
+// reportContent - private function, gets the report object from s3 (using the channel prefix)
+// the couchbase cas (version token) is returned so that the client can post updates
+func reportContent(con connectors.Clients, servisbotRequest *schema.ServisBOTRequest) (*schema.ReportContent, schema.Cas, int, error) {
+	bucket := os.Getenv(AWSBUCKET)
+	key, cas, code, err := reportKey(con, servisbotRequest)
+	if err != nil {
+		return nil, cas, code, err
+	}
+
+	opts := &s3.GetObjectInput{Bucket: &bucket, Key: &key}
+	data, err := con.GetObject(opts)
+	if err != nil {
+		// the object was deleted (the reconcile job removes documents without objects)
+		return nil, cas, objectErrorCode(err), err
+	}
+	return data, cas, http.StatusOK, nil
+}
+
+// reportKey - private function, returns the s3 object key (and the couchbase cas) for the report
+func reportKey(con connectors.Clients, servisbotRequest *schema.ServisBOTRequest) (string, schema.Cas, int, error) {
+	var cas schema.Cas
+
+	// the stored channel (if any) is used to find the object key prefix
+	channel := servisbotRequest.Data.ServisbotStats.Channel
+	rl, err := con.GetReport(servisbotRequest.Data.Id)
+	if err != nil {
+		con.Error("Function reportKey (get) couchbase %v", err)
+	} else {
+		cas = rl.Cas
+		if rl.ServisbotStats.Channel != "" {
+			channel = rl.ServisbotStats.Channel
+		}
+	}
+
+	prefix, err := channelPrefix(channel)
+	if err != nil {
+		return "", cas, http.StatusBadRequest, err
+	}
+	return prefix + servisbotRequest.Data.Id, cas, http.StatusOK, nil
+}
+
+// invalidateReport - private function, removes the cached report object (the next read downloads it again)
+func invalidateReport(con connectors.Clients, id string, channel string) {
+	prefix, err := channelPrefix(channel)
+	if err != nil {
+		con.Error("Function invalidateReport %v", err)
+		return
+	}
+	bucket := os.Getenv(AWSBUCKET)
+	key := prefix + id
+	con.InvalidateObject(&s3.GetObjectInput{Bucket: &bucket, Key: &key})
+}
+
+// runJob - private function, runs one pass of a background job and returns a panic as an error
+// the jobs run in their own goroutine (an unrecovered panic would stop the pod)
+func runJob(run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("recovered panic %v", r)
+		}
+	}()
+	return run()
+}
+
 // IsAlive - readiness & liveliness probe
 func IsAlive(w http.ResponseWriter, r *http.Request) {
 	// add header (cors) override for vuejs FE
@@ -334,8 +586,9 @@ func addHeaders(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set(CONTENTTYPE, APPLICATIONJSON)
 	// use this for cors
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Accept-Language")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Accept-Language, X-Request-ID")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
 }
 
 // responsErrorFormat - utility function
@@ -347,12 +600,75 @@ func responseErrorFormat(code int, w http.ResponseWriter, msg string, val ...int
 	return b
 }
 
-// verifyJwtToken - private function
-func verifyJwtToken(tokenStr string) (*schema.Credentials, error) {
+// responseGetReportError - utility function, maps a couchbase get error to not found or internal error
+func responseGetReportError(w http.ResponseWriter, name string, err error, con connectors.Clients) []byte {
+	code := http.StatusInternalServerError
+	if errors.Is(err, gocb.ErrDocumentNotFound) {
+		code = http.StatusNotFound
+	}
+	msg := name + " (get) couchbase  %v"
+	con.Error(msg, err)
+	return responseErrorFormat(code, w, msg, err)
+}
+
+// responseConflictFormat - utility function, returns the current document (and its cas) on a stale update
+func responseConflictFormat(w http.ResponseWriter, name string, id string, creds *schema.Credentials, con connectors.Clients) []byte {
+	var b []byte
+	response := &schema.Response{Code: http.StatusConflict, Status: "CONFLICT", Message: fmt.Sprintf("%s cas mismatch, document %s has been updated by another user", name, id)}
+	current, err := con.GetReport(id)
+	if err != nil {
+		con.Error("%s (conflict) couchbase %v", name, err)
+	} else {
+		current.ServisbotStats = redact.Get().List(creds.Role, current.ServisbotStats)
+		response.Cas = current.Cas
+		response.Reports = []schema.ReportList{*current}
+	}
+	w.WriteHeader(http.StatusConflict)
+	b, _ = json.MarshalIndent(response, "", "	")
+	return b
+}
+
+// patchSpecs - private function, converts the patch fields to sub-document specs
+// bot owned fields are rejected (forbidden) as are any fields we don't know about
+// the user classification is normalized (in place) with the affiliate's label taxonomy
+func patchSpecs(patch map[string]interface{}, affiliate string) ([]gocb.MutateInSpec, int, error) {
+	var specs []gocb.MutateInSpec
+	if len(patch) == 0 {
+		return specs, http.StatusBadRequest, errors.New("patch is empty")
+	}
+	for field, value := range patch {
+		if botFields[field] {
+			return specs, http.StatusForbidden, fmt.Errorf("field %s is owned by the bot and is read only", field)
+		}
+		if !reviewerFields[field] {
+			return specs, http.StatusBadRequest, fmt.Errorf("field %s can not be patched", field)
+		}
+		if _, ok := value.(string); !ok {
+			return specs, http.StatusBadRequest, fmt.Errorf("field %s must be a string", field)
+		}
+		if field == "UserClassification" {
+			label, err := taxonomy.Get().Normalize(affiliate, value.(string))
+			if err != nil {
+				return specs, http.StatusBadRequest, err
+			}
+			patch[field] = label
+			value = label
+		}
+		specs = append(specs, gocb.UpsertSpec(field, value, &gocb.UpsertSpecOptions{}))
+	}
+	return specs, http.StatusOK, nil
+}
+
+// verifyJwtToken - private function (the parsing is traced as a child of the request span)
+func verifyJwtToken(ctx context.Context, tokenStr string) (*schema.Credentials, error) {
 	var creds *schema.Credentials
+	var err error
+	_, span := tracing.Start(ctx, "jwt.Verify")
+	defer tracing.End(span, &err)
 
 	if tokenStr == "" {
-		return creds, errors.New("jwt token is invalid/empty")
+		err = errors.New("jwt token is invalid/empty")
+		return creds, err
 	}
 	// local function
 	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
@@ -368,12 +684,16 @@ func verifyJwtToken(tokenStr string) (*schema.Credentials, error) {
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		if claims["user"] == nil || claims["customerNumber"] == nil {
-			return creds, errors.New("JWT invalid user/customerNumber empty")
+			err = errors.New("JWT invalid user/customerNumber empty")
+			return creds, err
 		}
 		user := claims["user"].(string)
 		cn := claims["customerNumber"].(string)
-		creds = &schema.Credentials{User: user, Password: "", CustomerNumber: cn}
+		// the role is optional (callers without a role get the default redaction rules)
+		role, _ := claims["role"].(string)
+		creds = &schema.Credentials{User: user, Password: "", CustomerNumber: cn, Role: role}
 		return creds, nil
 	}
-	return creds, errors.New("jwt token is invalid")
+	err = errors.New("jwt token is invalid")
+	return creds, err
 }
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/buckets"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"github.com/aws/aws-sdk-go/service/s3"
+	gocb "github.com/couchbase/gocb/v2"
+)
+
+const (
+	INGESTTOKEN      string = "INGEST_TOKEN"
+	INGESTHEADER     string = "X-Ingest-Token"
+	COUCHBASEBUCKET  string = buckets.STATSBUCKET
+	DEADLETTERBUCKET string = buckets.DEADLETTER
+)
+
+var errIngestToken = errors.New("ingest token is invalid/empty")
+
+// IngestHandler - handler that accepts s3 event notifications (sns wrapped or raw) for new report objects
+// each report is fetched, validated and its ListObject projection is inserted in couchbase
+// an existing document (a reprocessed report or a redelivered event) only gets the bot owned fields, so the writes are idempotent
+// and the reviewer changes are kept, failed records are written to the dead-letter bucket
+func IngestHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	addHeaders(w, r)
+
+	// ensure we don't have nil - it will cause a null pointer exception
+	if r.Body == nil {
+		r.Body = ioutil.NopCloser(bytes.NewBufferString(""))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "IngestHandler body data error : %v"
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// s3 and sns can't send a jwt so a shared token is used (sns subscriptions can only pass it as a query param)
+	// the body is only traced for an authorized caller
+	if !ingestAuthorized(r) {
+		msg := "IngestHandler %v"
+		con.Error(msg, errIngestToken)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, errIngestToken)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	con.TraceBody("IngestHandler request body : %s", body)
+
+	event, subscribeURL, err := ingestEvent(body)
+	if err != nil {
+		msg := "IngestHandler could not unmarshal s3 event %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusBadRequest, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// the subscription is confirmed by an operator (we don't call urls taken from the request)
+	if subscribeURL != "" {
+		con.Info("IngestHandler sns subscription confirmation required : %s", subscribeURL)
+		response := &schema.IngestResponse{Code: http.StatusOK, Status: "OK", Message: "IngestHandler sns subscription confirmation logged"}
+		w.WriteHeader(http.StatusOK)
+		b, _ := json.MarshalIndent(response, "", "	")
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// a non 2xx response makes sns/s3 retry, so it is only returned when a failed record could not be dead-lettered
+	code, status := http.StatusOK, "OK"
+	var results []schema.IngestResult
+	for _, record := range event.Records {
+		result, err := ingestRecord(con, record)
+		if err != nil {
+			result = ingestDeadLetter(con, record, result, err)
+		}
+		if result.Status == "ERROR" {
+			code, status = http.StatusInternalServerError, "ERROR"
+		}
+		results = append(results, result)
+	}
+
+	response := &schema.IngestResponse{Code: code, Status: status, Message: fmt.Sprintf("IngestHandler processed %d records", len(results)), Results: results}
+	w.WriteHeader(code)
+	b, _ := json.MarshalIndent(response, "", "	")
+	fmt.Fprintf(w, string(b))
+	return
+}
+
+// ingestAuthorized - private function, compares the request token (header or query param) with INGEST_TOKEN
+func ingestAuthorized(r *http.Request) bool {
+	expected := os.Getenv(INGESTTOKEN)
+	token := r.Header.Get(INGESTHEADER)
+	if token == "" {
+		token = r.URL.Query().Get("token")
+	}
+	if expected == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+// ingestEvent - private function, unwraps an sns notification (if any) and returns the s3 event
+// for an sns subscription confirmation the SubscribeURL is returned instead
+func ingestEvent(body []byte) (*schema.S3Event, string, error) {
+	var sns *schema.SNSMessage
+	var event *schema.S3Event
+
+	err := json.Unmarshal(body, &sns)
+	if err != nil {
+		return nil, "", err
+	}
+	switch sns.Type {
+	case "SubscriptionConfirmation":
+		return nil, sns.SubscribeURL, nil
+	case "Notification":
+		body = []byte(sns.Message)
+	}
+
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		return nil, "", err
+	}
+	// the s3 test event (sent when notifications are configured) has no records
+	if event.Event == "" && len(event.Records) == 0 {
+		return nil, "", errors.New("no s3 event records found")
+	}
+	return event, "", nil
+}
+
+// ingestRecord - private function, ingests the object of a created event (other events are skipped)
+func ingestRecord(con connectors.Clients, record schema.S3EventRecord) (schema.IngestResult, error) {
+	result := schema.IngestResult{Key: record.S3.Object.Key}
+	if !strings.HasPrefix(record.EventName, "ObjectCreated:") {
+		result.Status = "SKIPPED"
+		return result, nil
+	}
+
+	bucket := os.Getenv(AWSBUCKET)
+	if record.S3.Bucket.Name != bucket {
+		return result, fmt.Errorf("unexpected bucket %s", record.S3.Bucket.Name)
+	}
+
+	// object keys are url encoded in s3 events
+	key, err := url.QueryUnescape(record.S3.Object.Key)
+	if err != nil {
+		return result, err
+	}
+	result.Key = key
+
+	result.Id, result.Status, err = ingestObject(con, bucket, key)
+	return result, err
+}
+
+// ingestObject - private function, inserts the projection of the report object
+// the status is UPDATED when the document was already there (the bot reprocessed the report or the event was redelivered)
+func ingestObject(con connectors.Clients, bucket string, key string) (string, string, error) {
+	id, projection, err := projectObject(con, bucket, key)
+	if err != nil {
+		return id, "", err
+	}
+
+	_, err = con.Insert(os.Getenv(COUCHBASEBUCKET), id, projection, &gocb.InsertOptions{})
+	if errors.Is(err, gocb.ErrDocumentExists) {
+		// the stored document may already have reviewer changes, only the bot owned fields are refreshed
+		err = updateBotFields(con, id, projection)
+		if err != nil {
+			return id, "", err
+		}
+		return id, "UPDATED", nil
+	}
+	if err != nil {
+		return id, "", err
+	}
+	return id, "OK", nil
+}
+
+// projectObject - private function, fetches and validates the report object and returns its id and ListObject projection
+func projectObject(con connectors.Clients, bucket string, key string) (string, *schema.ListObject, error) {
+	id, channel, err := reportId(key)
+	if err != nil {
+		return id, nil, err
+	}
+
+	// the object was (re)written so a cached copy is stale
+	in := &s3.GetObjectInput{Bucket: &bucket, Key: &key}
+	con.InvalidateObject(in)
+	report, err := con.GetObject(in)
+	if err != nil {
+		return id, nil, err
+	}
+	if report.Channel == "" {
+		report.Channel = channel
+	}
+	err = report.Validate()
+	if err != nil {
+		return id, nil, err
+	}
+	projection := report.Projection()
+	return id, &projection, nil
+}
+
+// ingestDeadLetter - private function, stores the failed record so that it can be replayed
+func ingestDeadLetter(con connectors.Clients, record schema.S3EventRecord, result schema.IngestResult, cause error) schema.IngestResult {
+	con.Error("Function ingestRecord %s %v", result.Key, cause)
+	now := time.Now()
+	dl := &schema.DeadLetter{
+		Id:        fmt.Sprintf("deadletter::%s::%d", result.Key, now.UnixNano()),
+		Bucket:    record.S3.Bucket.Name,
+		Key:       result.Key,
+		EventName: record.EventName,
+		Error:     cause.Error(),
+		Timestamp: now.UnixNano() / int64(time.Millisecond),
+		Record:    record,
+	}
+	_, err := con.Insert(DEADLETTERBUCKET, dl.Id, dl, &gocb.InsertOptions{})
+	if err != nil {
+		con.Error("Function ingestDeadLetter (insert) couchbase %v", err)
+		result.Status, result.Message = "ERROR", fmt.Sprintf("%v (dead-letter failed %v)", cause, err)
+		return result
+	}
+	result.Status, result.Message = "DEADLETTER", cause.Error()
+	return result
+}
+
+// reportId - private function, splits the object key into the report id and its channel (using the channel prefixes)
+func reportId(key string) (string, string, error) {
+	var id, channel string
+	for name, prefix := range channelPrefixes() {
+		// the longest matching prefix wins (prefixes can be nested)
+		if strings.HasPrefix(key, prefix) && (channel == "" || len(prefix) > len(key)-len(id)) {
+			id, channel = strings.TrimPrefix(key, prefix), name
+		}
+	}
+	if channel == "" || id == "" {
+		return "", "", fmt.Errorf("object key %s does not match a channel prefix", key)
+	}
+	return id, channel, nil
+}
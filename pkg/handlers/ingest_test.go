@@ -0,0 +1,404 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+)
+
+// TestIngestHandlers - s3 event ingestion test entry point
+func TestIngestHandlers(t *testing.T) {
+
+	logger := &logging.Logger{Level: "trace"}
+
+	t.Run("IngestHandler : should pass (raw s3 event)", func(t *testing.T) {
+		var STATUS int = 200
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "1212121")
+		os.Setenv("AWS_BUCKET", "servisbot")
+		os.Setenv("COUCHBASE_BUCKET", "servisbotstats")
+
+		requestPayload := `{"Records": [{"eventName": "ObjectCreated:Put", "eventTime": "2020-08-11T11:08:28.220Z", "s3": {"bucket": {"name": "servisbot"}, "object": {"key": "Email/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1", "size": 1024}}}, {"eventName": "ObjectRemoved:Delete", "eventTime": "2020-08-11T11:08:28.220Z", "s3": {"bucket": {"name": "servisbot"}, "object": {"key": "Email/0ab1la532icnaatgbnkst3nsl95g8llcdnvmqko1", "size": 1024}}}]}`
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=1212121", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors(STATUS, logger)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+		if !strings.Contains(string(body), `"status": "OK"`) {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect results - got (%s)", "IngestHandler", string(body)))
+		}
+		if !strings.Contains(string(body), `"status": "SKIPPED"`) {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect results - got (%s)", "IngestHandler", string(body)))
+		}
+		if !strings.Contains(string(body), `"id": "7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1"`) {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect results - got (%s)", "IngestHandler", string(body)))
+		}
+	})
+
+	t.Run("IngestHandler : should pass (sns notification)", func(t *testing.T) {
+		var STATUS int = 200
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "1212121")
+		os.Setenv("AWS_BUCKET", "servisbot")
+		os.Setenv("COUCHBASE_BUCKET", "servisbotstats")
+
+		requestPayload := `{"Type": "Notification", "MessageId": "22b80b92-fdea-4c2c-8f9d-bdfb0c7bf324", "TopicArn": "arn:aws:sns:us-east-1:123456789012:servisbot-reports", "Message": "{\"Records\": [{\"eventName\": \"ObjectCreated:Put\", \"eventTime\": \"2020-08-11T11:08:28.220Z\", \"s3\": {\"bucket\": {\"name\": \"servisbot\"}, \"object\": {\"key\": \"Chat/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1\", \"size\": 1024}}}]}"}`
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=1212121", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors(STATUS, logger)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+		if !strings.Contains(string(body), `"status": "OK"`) {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect results - got (%s)", "IngestHandler", string(body)))
+		}
+	})
+
+	t.Run("IngestHandler : should pass (reprocessed report updates the bot fields)", func(t *testing.T) {
+		var STATUS int = 200
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "1212121")
+		os.Setenv("AWS_BUCKET", "servisbot")
+		os.Setenv("COUCHBASE_BUCKET", "servisbotstats")
+
+		requestPayload := `{"Records": [{"eventName": "ObjectCreated:Put", "eventTime": "2020-08-11T11:08:28.220Z", "s3": {"bucket": {"name": "servisbot"}, "object": {"key": "Email/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1", "size": 1024}}}, {"eventName": "ObjectRemoved:Delete", "eventTime": "2020-08-11T11:08:28.220Z", "s3": {"bucket": {"name": "servisbot"}, "object": {"key": "Email/0ab1la532icnaatgbnkst3nsl95g8llcdnvmqko1", "size": 1024}}}]}`
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=1212121", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors(STATUS, logger)
+		conn.Meta("exists")
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+		if !strings.Contains(string(body), `"status": "UPDATED"`) {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect results - got (%s)", "IngestHandler", string(body)))
+		}
+	})
+
+	t.Run("IngestHandler : should pass (sns subscription confirmation)", func(t *testing.T) {
+		var STATUS int = 200
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "1212121")
+		os.Setenv("AWS_BUCKET", "servisbot")
+		os.Setenv("COUCHBASE_BUCKET", "servisbotstats")
+
+		requestPayload := `{"Type": "SubscriptionConfirmation", "TopicArn": "arn:aws:sns:us-east-1:123456789012:servisbot-reports", "SubscribeURL": "https://sns.us-east-1.amazonaws.com/?Action=ConfirmSubscription&TopicArn=arn:aws:sns:us-east-1:123456789012:servisbot-reports&Token=2336412f37"}`
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=1212121", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors(STATUS, logger)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+	})
+
+	t.Run("IngestHandler : should pass (s3 test event)", func(t *testing.T) {
+		var STATUS int = 200
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "1212121")
+		os.Setenv("AWS_BUCKET", "servisbot")
+		os.Setenv("COUCHBASE_BUCKET", "servisbotstats")
+
+		requestPayload := `{"Service": "Amazon S3", "Event": "s3:TestEvent", "Time": "2020-08-11T11:08:28.220Z", "Bucket": "servisbot"}`
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=1212121", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors(STATUS, logger)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+	})
+
+	t.Run("IngestHandler : should pass (unknown prefix is dead-lettered)", func(t *testing.T) {
+		var STATUS int = 200
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "1212121")
+		os.Setenv("AWS_BUCKET", "servisbot")
+		os.Setenv("COUCHBASE_BUCKET", "servisbotstats")
+
+		requestPayload := `{"Records": [{"eventName": "ObjectCreated:Put", "eventTime": "2020-08-11T11:08:28.220Z", "s3": {"bucket": {"name": "servisbot"}, "object": {"key": "Fax/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1", "size": 1024}}}]}`
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=1212121", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors(STATUS, logger)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+		if !strings.Contains(string(body), `"status": "DEADLETTER"`) {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect results - got (%s)", "IngestHandler", string(body)))
+		}
+	})
+
+	t.Run("IngestHandler : should pass (unexpected bucket is dead-lettered)", func(t *testing.T) {
+		var STATUS int = 200
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "1212121")
+		os.Setenv("AWS_BUCKET", "servisbot")
+		os.Setenv("COUCHBASE_BUCKET", "servisbotstats")
+
+		requestPayload := `{"Records": [{"eventName": "ObjectCreated:Put", "eventTime": "2020-08-11T11:08:28.220Z", "s3": {"bucket": {"name": "other"}, "object": {"key": "Email/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1", "size": 1024}}}]}`
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=1212121", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors(STATUS, logger)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+		if !strings.Contains(string(body), `"status": "DEADLETTER"`) {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect results - got (%s)", "IngestHandler", string(body)))
+		}
+	})
+
+	t.Run("IngestHandler : should fail (dead-letter write error)", func(t *testing.T) {
+		var STATUS int = 500
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "1212121")
+		os.Setenv("AWS_BUCKET", "servisbot")
+		os.Setenv("COUCHBASE_BUCKET", "servisbotstats")
+
+		requestPayload := `{"Records": [{"eventName": "ObjectCreated:Put", "eventTime": "2020-08-11T11:08:28.220Z", "s3": {"bucket": {"name": "servisbot"}, "object": {"key": "Email/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1", "size": 1024}}}, {"eventName": "ObjectRemoved:Delete", "eventTime": "2020-08-11T11:08:28.220Z", "s3": {"bucket": {"name": "servisbot"}, "object": {"key": "Email/0ab1la532icnaatgbnkst3nsl95g8llcdnvmqko1", "size": 1024}}}]}`
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=1212121", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors(STATUS, logger)
+		conn.Meta("true")
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+		if !strings.Contains(string(body), `"status": "ERROR"`) {
+			t.Errorf(fmt.Sprintf("Handler %s returned incorrect results - got (%s)", "IngestHandler", string(body)))
+		}
+	})
+
+	t.Run("IngestHandler : should fail (force read body error)", func(t *testing.T) {
+		var STATUS int = 500
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "1212121")
+		os.Setenv("AWS_BUCKET", "servisbot")
+		os.Setenv("COUCHBASE_BUCKET", "servisbotstats")
+
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=1212121", errReader(0))
+		conn := NewTestConnectors(STATUS, logger)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+	})
+
+	t.Run("IngestHandler : should fail (invalid token)", func(t *testing.T) {
+		var STATUS int = 403
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "1212121")
+		os.Setenv("AWS_BUCKET", "servisbot")
+		os.Setenv("COUCHBASE_BUCKET", "servisbotstats")
+
+		requestPayload := `{"Records": [{"eventName": "ObjectCreated:Put", "eventTime": "2020-08-11T11:08:28.220Z", "s3": {"bucket": {"name": "servisbot"}, "object": {"key": "Email/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1", "size": 1024}}}, {"eventName": "ObjectRemoved:Delete", "eventTime": "2020-08-11T11:08:28.220Z", "s3": {"bucket": {"name": "servisbot"}, "object": {"key": "Email/0ab1la532icnaatgbnkst3nsl95g8llcdnvmqko1", "size": 1024}}}]}`
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=invalid", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors(STATUS, logger)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+	})
+
+	t.Run("IngestHandler : should fail (no token configured)", func(t *testing.T) {
+		var STATUS int = 403
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "")
+		os.Setenv("AWS_BUCKET", "servisbot")
+
+		requestPayload := `{"Records": [{"eventName": "ObjectCreated:Put", "eventTime": "2020-08-11T11:08:28.220Z", "s3": {"bucket": {"name": "servisbot"}, "object": {"key": "Email/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1", "size": 1024}}}, {"eventName": "ObjectRemoved:Delete", "eventTime": "2020-08-11T11:08:28.220Z", "s3": {"bucket": {"name": "servisbot"}, "object": {"key": "Email/0ab1la532icnaatgbnkst3nsl95g8llcdnvmqko1", "size": 1024}}}]}`
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=1212121", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors(STATUS, logger)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+	})
+
+	t.Run("IngestHandler : should fail (invalid event)", func(t *testing.T) {
+		var STATUS int = 400
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "1212121")
+		os.Setenv("AWS_BUCKET", "servisbot")
+		os.Setenv("COUCHBASE_BUCKET", "servisbotstats")
+
+		requestPayload := `{"Records": "invalid"}`
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=1212121", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors(STATUS, logger)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+	})
+
+	t.Run("IngestHandler : should fail (no records)", func(t *testing.T) {
+		var STATUS int = 400
+		os.Setenv("TOKEN", "1212121")
+		os.Setenv("JWT_SECRETKEY", "Thr33f0ldSystems?CSsD!@%2^")
+		os.Setenv("INGEST_TOKEN", "1212121")
+		os.Setenv("AWS_BUCKET", "servisbot")
+		os.Setenv("COUCHBASE_BUCKET", "servisbotstats")
+
+		requestPayload := `{}`
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/ingest/s3event?token=1212121", bytes.NewBuffer([]byte(requestPayload)))
+		conn := NewTestConnectors(STATUS, logger)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			IngestHandler(w, r, conn)
+		})
+		handler.ServeHTTP(rr, req)
+		body, e := ioutil.ReadAll(rr.Body)
+		if e != nil {
+			t.Fatalf("Should not fail : found error %v", e)
+		}
+		logger.Trace(fmt.Sprintf("Response %s", string(body)))
+		// ignore errors here
+		if rr.Code != STATUS {
+			t.Errorf(fmt.Sprintf("Handler %s returned with incorrect status code - got (%d) wanted (%d)", "IngestHandler", rr.Code, STATUS))
+		}
+	})
+
+	t.Run("reportId : should pass (longest prefix wins)", func(t *testing.T) {
+		os.Setenv("CHANNEL_PREFIXES", "Email=reports/,Chat=reports/chat/")
+		id, channel, err := reportId("reports/chat/13124")
+		if err != nil || id != "13124" || channel != "Chat" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect id - got (%s %s %v) wanted (%s %s)", "reportId", id, channel, err, "13124", "Chat"))
+		}
+		os.Unsetenv("CHANNEL_PREFIXES")
+	})
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/redact"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	PRESIGNEXPIRY    string        = "PRESIGN_EXPIRY"
+	presignDefault   time.Duration = 5 * time.Minute
+	presignMaxExpiry time.Duration = time.Hour
+)
+
+// PresignHandler - handler that returns short lived presigned GET urls for the report object and the original email
+// the client downloads the objects directly from s3 (nothing is streamed through the pod)
+func PresignHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	var servisbotRequest *schema.ServisBOTRequest
+	addHeaders(w, r)
+
+	// read the jwt token data in the body
+	// we don't use authorization header as the token can get quite large due to form data
+	// ensure we don't have nil - it will cause a null pointer exception
+	if r.Body == nil {
+		r.Body = ioutil.NopCloser(bytes.NewBufferString(""))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "PresignHandler body data %v"
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	con.TraceBody("PresignHandler request body : %s", body)
+
+	errs := json.Unmarshal(body, &servisbotRequest)
+	if errs != nil {
+		msg := "PresignHandler could not unmarshal input data from servisBOT to schema %v"
+		con.Error(msg, errs)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, errs)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// check the jwt token
+	creds, err := verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
+	if err != nil {
+		msg := "PresignHandler verifyToken  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// presigned urls give the unredacted objects so only roles that can unmask may request them
+	if !redact.Get().CanUnmask(creds.Role) {
+		msg := "PresignHandler %v"
+		con.Error(msg, redact.ErrUnmaskDenied)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, redact.ErrUnmaskDenied)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	expiry := presignExpiry()
+	bucket := os.Getenv(AWSBUCKET)
+	key, _, code, err := reportKey(con, servisbotRequest)
+	if err != nil {
+		msg := "PresignHandler %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	reportUrl, err := con.PresignGetObject(&s3.GetObjectInput{Bucket: &bucket, Key: &key}, expiry)
+	if err != nil {
+		msg := "PresignHandler (report) %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+	// the url is only returned when its use is audited
+	err = insertAudit(con, creds, PRESIGN, servisbotRequest.Data.Id, "ReportUrl", "", key)
+	if err != nil {
+		msg := "PresignHandler (audit) %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	var emailUrl string
+	emailKey, err := presignEmailKey(con, bucket, key, servisbotRequest.Data.Id)
+	if err != nil {
+		msg := "PresignHandler (report) %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+	if emailKey != "" {
+		emailKey = os.Getenv(AWSEMAILPREFIX) + emailKey
+		emailUrl, err = con.PresignGetObject(&s3.GetObjectInput{Bucket: &bucket, Key: &emailKey}, expiry)
+		if err != nil {
+			msg := "PresignHandler (email) %v"
+			con.Error(msg, err)
+			b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+			fmt.Fprintf(w, string(b))
+			return
+		}
+		err = insertAudit(con, creds, PRESIGN, servisbotRequest.Data.Id, "EmailUrl", "", emailKey)
+		if err != nil {
+			msg := "PresignHandler (audit) %v"
+			con.Error(msg, err)
+			b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+			fmt.Fprintf(w, string(b))
+			return
+		}
+	}
+
+	response := &schema.PresignResponse{Code: http.StatusOK, Status: "OK", Message: "PresignHandler urls issued successfully", Expires: time.Now().Add(expiry).Unix(), ReportUrl: reportUrl, EmailUrl: emailUrl}
+	w.WriteHeader(http.StatusOK)
+	b, _ := json.MarshalIndent(response, "", "	")
+	fmt.Fprintf(w, string(b))
+	return
+}
+
+// presignEmailKey - private function, the key of the original email (empty when the report has none)
+// the key is read from the stats document, only email reports projected before the key was added read the (cached) report object
+func presignEmailKey(con connectors.Clients, bucket string, key string, id string) (string, error) {
+	rl, err := con.GetReport(id)
+	if err == nil {
+		stats := rl.ServisbotStats
+		if stats.EmailS3Key != "" || (stats.Channel != "" && stats.Channel != schema.CHANNELEMAIL) {
+			return stats.EmailS3Key, nil
+		}
+	}
+	report, err := con.GetObject(&s3.GetObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		return "", err
+	}
+	return report.EmailS3Key, nil
+}
+
+// presignExpiry - private function, reads PRESIGN_EXPIRY (a go duration i.e 90s, 10m)
+// the default is 5 minutes and the value is capped at 1 hour so that urls stay short lived
+func presignExpiry() time.Duration {
+	d, err := time.ParseDuration(os.Getenv(PRESIGNEXPIRY))
+	if err != nil || d <= 0 {
+		return presignDefault
+	}
+	if d > presignMaxExpiry {
+		return presignMaxExpiry
+	}
+	return d
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/buckets"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"github.com/aws/aws-sdk-go/service/s3"
+	gocb "github.com/couchbase/gocb/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	ORPHANBUCKET      string = buckets.ORPHANS
+	RECONCILEINTERVAL string = "RECONCILE_INTERVAL"
+	RECONCILEDRYRUN   string = "RECONCILE_DRY_RUN"
+	MISSINGDOCUMENT   string = "missing_document"
+	MISSINGOBJECT     string = "missing_object"
+)
+
+// errReconcileSkipped - the orphan was not repaired (its object exists or can't be checked)
+var errReconcileSkipped = errors.New("not repaired")
+
+var (
+	reconcileLock    sync.Mutex
+	reconcileScanned = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reconcile_scanned_total",
+		Help: "Number of s3 objects and couchbase documents scanned by the reconciliation job.",
+	}, []string{"source"})
+	reconcileOrphans = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "reconcile_orphans",
+		Help: "Number of orphans found by the last reconciliation run.",
+	}, []string{"kind"})
+	reconcileRepaired = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "reconcile_repaired_total",
+		Help: "Number of orphans repaired by the reconciliation job.",
+	}, []string{"kind", "result"})
+	reconcileLastRun = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "reconcile_last_run_timestamp_seconds",
+		Help: "Unix time the last reconciliation run finished.",
+	})
+)
+
+// Reconcile - compares the report objects (for every channel prefix) with the servisbotstats document ids
+// objects without a document are ingested, documents without an object are moved to the orphans bucket
+// with dryRun set the drift is only reported
+// the ids are read before the objects are listed so a report ingested during the run is never seen as a document without
+// an object, and the object of every such document is checked again (HeadObject on its channel key) before it is moved
+func Reconcile(con connectors.Clients, dryRun bool) (*schema.ReconcileReport, error) {
+	// a scheduled run and a manual run in this process must not overlap (runs on other pods are safe, every repair is idempotent)
+	reconcileLock.Lock()
+	defer reconcileLock.Unlock()
+
+	report := &schema.ReconcileReport{DryRun: dryRun, Started: time.Now().Unix(), MissingDocuments: []string{}, MissingObjects: []string{}}
+	bucket := os.Getenv(AWSBUCKET)
+
+	ids, err := con.GetIds()
+	if err != nil {
+		return report, err
+	}
+	objects, err := reconcileObjects(con, bucket)
+	if err != nil {
+		return report, err
+	}
+	report.Objects, report.Documents = len(objects), len(ids)
+	reconcileScanned.WithLabelValues("couchbase").Add(float64(len(ids)))
+
+	documents := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		documents[id] = true
+		if _, ok := objects[id]; !ok {
+			report.MissingObjects = append(report.MissingObjects, id)
+		}
+	}
+	for id, key := range objects {
+		if !documents[id] {
+			report.MissingDocuments = append(report.MissingDocuments, key)
+		}
+	}
+	sort.Strings(report.MissingDocuments)
+	sort.Strings(report.MissingObjects)
+	reconcileOrphans.WithLabelValues(MISSINGDOCUMENT).Set(float64(len(report.MissingDocuments)))
+	reconcileOrphans.WithLabelValues(MISSINGOBJECT).Set(float64(len(report.MissingObjects)))
+	con.Info("Reconcile %d objects %d documents : %d missing documents %d missing objects (dry run %t)", report.Objects, report.Documents, len(report.MissingDocuments), len(report.MissingObjects), dryRun)
+
+	if !dryRun {
+		for _, key := range report.MissingDocuments {
+			_, _, err := ingestObject(con, bucket, key)
+			reconcileResult(con, report, MISSINGDOCUMENT, key, err)
+		}
+		for _, id := range report.MissingObjects {
+			reconcileResult(con, report, MISSINGOBJECT, id, reconcileOrphan(con, bucket, id))
+		}
+	}
+
+	report.Finished = time.Now().Unix()
+	reconcileLastRun.Set(float64(report.Finished))
+	return report, nil
+}
+
+// ReconcileJob - runs Reconcile every RECONCILE_INTERVAL (a go duration) until stop is closed
+// the job is disabled when the interval is not set, it runs on every replica so it only reports the drift
+// unless RECONCILE_DRY_RUN=false (the reconcile command repairs from a single cronjob)
+func ReconcileJob(con connectors.Clients, stop <-chan struct{}) {
+	interval, err := time.ParseDuration(os.Getenv(RECONCILEINTERVAL))
+	if err != nil || interval <= 0 {
+		con.Info("Reconcile job : disabled (%s not set)", RECONCILEINTERVAL)
+		return
+	}
+	dryRun := reconcileDryRun()
+	con.Info("Reconcile job : running every %v (dry run %t)", interval, dryRun)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			err := runJob(func() error {
+				_, err := Reconcile(con, dryRun)
+				return err
+			})
+			if err != nil {
+				con.Error("Reconcile job : %v", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// reconcileDryRun - private function, the scheduled job only repairs when RECONCILE_DRY_RUN is false
+func reconcileDryRun() bool {
+	return os.Getenv(RECONCILEDRYRUN) != "false"
+}
+
+// reconcileObjects - private function, lists every report object (page by page) and maps the report id to its key
+func reconcileObjects(con connectors.Clients, bucket string) (map[string]string, error) {
+	objects := make(map[string]string)
+	for _, prefix := range channelPrefixes() {
+		input := &s3.ListObjectsV2Input{Bucket: &bucket, Prefix: &prefix}
+		for {
+			out, err := con.ListObjects(input)
+			if err != nil {
+				return objects, err
+			}
+			for _, obj := range out.Contents {
+				if id, _, err := reportId(*obj.Key); err == nil {
+					objects[id] = *obj.Key
+				}
+			}
+			reconcileScanned.WithLabelValues("s3").Add(float64(len(out.Contents)))
+			con.Debug("Reconcile listed %d objects for prefix %s (total %d)", len(out.Contents), prefix, len(objects))
+			if out.IsTruncated == nil || !*out.IsTruncated {
+				break
+			}
+			input.ContinuationToken = out.NextContinuationToken
+		}
+	}
+	return objects, nil
+}
+
+// reconcileOrphan - private function, copies the document to the orphans bucket and removes it from servisbotstats
+// (the reviewer classification is kept in case the object is restored)
+// the document is skipped when its object exists (written after the listing or under a prefix that was not listed)
+// or when its channel has no configured prefix (the object can't be checked)
+func reconcileOrphan(con connectors.Clients, bucket string, id string) error {
+	current, err := con.GetReport(id)
+	if err != nil {
+		return err
+	}
+	prefix, err := channelPrefix(current.ServisbotStats.Channel)
+	if err != nil {
+		return fmt.Errorf("%w : %v", errReconcileSkipped, err)
+	}
+	key := prefix + id
+	_, err = con.HeadObject(&s3.HeadObjectInput{Bucket: &bucket, Key: &key})
+	if err == nil {
+		return fmt.Errorf("%w : object %s exists", errReconcileSkipped, key)
+	}
+	if objectErrorCode(err) != http.StatusNotFound {
+		return err
+	}
+	// the copy can already exist when a previous remove failed
+	_, err = con.Insert(ORPHANBUCKET, id, current.ServisbotStats, &gocb.InsertOptions{})
+	if err != nil && !errors.Is(err, gocb.ErrDocumentExists) {
+		return err
+	}
+	_, err = con.Remove(id, &gocb.RemoveOptions{Cas: gocb.Cas(current.Cas)})
+	return err
+}
+
+// reconcileResult - private function, counts and logs the outcome of a repair
+func reconcileResult(con connectors.Clients, report *schema.ReconcileReport, kind string, name string, err error) {
+	if errors.Is(err, errReconcileSkipped) {
+		con.Info("Reconcile %s %s %v", kind, name, err)
+		report.Skipped++
+		reconcileRepaired.WithLabelValues(kind, "skipped").Inc()
+		return
+	}
+	if err != nil {
+		con.Error("Reconcile %s %s %v", kind, name, err)
+		report.Failed++
+		reconcileRepaired.WithLabelValues(kind, "failed").Inc()
+		return
+	}
+	report.Repaired++
+	reconcileRepaired.WithLabelValues(kind, "ok").Inc()
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+)
+
+// TestReconcile - reconciliation test entry point
+func TestReconcile(t *testing.T) {
+
+	logger := &logging.Logger{Level: "trace"}
+
+	t.Run("Reconcile : should pass (dry run)", func(t *testing.T) {
+		os.Setenv("AWS_BUCKET", "servisbot")
+		conn := NewTestConnectors(200, logger)
+		report, err := Reconcile(conn, true)
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Function %s returned with error - got (%v) wanted (%v)", "Reconcile", err, nil))
+		}
+		if report.Objects != 2 || report.Documents != 2 || len(report.MissingDocuments) != 1 || len(report.MissingObjects) != 1 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect drift - got (%v)", "Reconcile", report))
+		}
+		if report.MissingDocuments[0] != "Email/7ugvla532icnaatgbnkst3nsl95g8llcdnvmqko1" || report.MissingObjects[0] != "0orphan0000000000000000000000000000000001.json" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect orphans - got (%v %v)", "Reconcile", report.MissingDocuments, report.MissingObjects))
+		}
+		if report.Repaired != 0 || report.Failed != 0 {
+			t.Errorf(fmt.Sprintf("Function %s repaired in dry run mode - got (%d %d)", "Reconcile", report.Repaired, report.Failed))
+		}
+	})
+
+	t.Run("Reconcile : should pass (repair both directions)", func(t *testing.T) {
+		conn := NewTestConnectors(200, logger)
+		report, err := Reconcile(conn, false)
+		if err != nil || report.Repaired != 2 || report.Failed != 0 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect repairs - got (%v %v)", "Reconcile", report, err))
+		}
+	})
+
+	t.Run("Reconcile : should pass (failed repairs are counted)", func(t *testing.T) {
+		conn := NewTestConnectors(200, logger)
+		conn.Meta("remove")
+		report, err := Reconcile(conn, false)
+		if err != nil || report.Repaired != 1 || report.Failed != 1 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect repairs - got (%v %v)", "Reconcile", report, err))
+		}
+	})
+
+	t.Run("Reconcile : should pass (object written after the listing, the document is kept)", func(t *testing.T) {
+		conn := NewTestConnectors(200, logger)
+		conn.Meta("head")
+		report, err := Reconcile(conn, false)
+		if err != nil || report.Repaired != 1 || report.Skipped != 1 || report.Failed != 0 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect repairs - got (%v %v)", "Reconcile", report, err))
+		}
+	})
+
+	t.Run("Reconcile : should pass (channel prefix removed, the documents are kept)", func(t *testing.T) {
+		os.Setenv("CHANNEL_PREFIXES", "Chat=Chat/")
+		defer os.Unsetenv("CHANNEL_PREFIXES")
+		conn := NewTestConnectors(200, logger)
+		report, err := Reconcile(conn, false)
+		if err != nil || len(report.MissingObjects) != 2 || report.Repaired != 0 || report.Skipped != 2 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect repairs - got (%v %v)", "Reconcile", report, err))
+		}
+	})
+
+	t.Run("Reconcile : should fail (s3 list error)", func(t *testing.T) {
+		conn := NewTestConnectors(200, logger)
+		conn.Meta("list")
+		_, err := Reconcile(conn, true)
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Reconcile", err, "error"))
+		}
+	})
+
+	t.Run("Reconcile : should fail (couchbase ids error)", func(t *testing.T) {
+		conn := NewTestConnectors(200, logger)
+		conn.Meta("ids")
+		_, err := Reconcile(conn, true)
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Reconcile", err, "error"))
+		}
+	})
+
+	t.Run("ReconcileJob : should pass (disabled without interval)", func(t *testing.T) {
+		os.Unsetenv("RECONCILE_INTERVAL")
+		conn := NewTestConnectors(200, logger)
+		// returns immediately
+		ReconcileJob(conn, make(chan struct{}))
+	})
+
+	t.Run("ReconcileJob : should pass (dry run unless disabled)", func(t *testing.T) {
+		os.Unsetenv("RECONCILE_DRY_RUN")
+		if !reconcileDryRun() {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect data - got (%t) wanted (%t)", "reconcileDryRun", false, true))
+		}
+		os.Setenv("RECONCILE_DRY_RUN", "false")
+		defer os.Unsetenv("RECONCILE_DRY_RUN")
+		if reconcileDryRun() {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect data - got (%t) wanted (%t)", "reconcileDryRun", true, false))
+		}
+	})
+
+	t.Run("ReconcileJob : should pass (runs until stopped)", func(t *testing.T) {
+		os.Setenv("RECONCILE_INTERVAL", "10ms")
+		os.Setenv("RECONCILE_DRY_RUN", "true")
+		conn := NewTestConnectors(200, logger)
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			ReconcileJob(conn, stop)
+			close(done)
+		}()
+		time.Sleep(30 * time.Millisecond)
+		close(stop)
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Errorf(fmt.Sprintf("Function %s did not stop", "ReconcileJob"))
+		}
+		os.Unsetenv("RECONCILE_INTERVAL")
+		os.Unsetenv("RECONCILE_DRY_RUN")
+	})
+}
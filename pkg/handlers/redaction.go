@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"net/http"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/redact"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+)
+
+const (
+	UNMASK string = "unmask"
+)
+
+// checkUnmask - private function, reports if the response can be returned unredacted
+// unmask is an explicit request flag, the caller's role must be allowed to unmask and every use is audited
+// when the audit record can't be written the response is not returned (500)
+func checkUnmask(con connectors.Clients, creds *schema.Credentials, servisbotRequest *schema.ServisBOTRequest, object string) (bool, int, error) {
+	if !servisbotRequest.Unmask {
+		return false, http.StatusOK, nil
+	}
+	if !redact.Get().CanUnmask(creds.Role) {
+		return false, http.StatusForbidden, redact.ErrUnmaskDenied
+	}
+	if err := insertAudit(con, creds, UNMASK, servisbotRequest.Data.Id, object, "", creds.Role); err != nil {
+		return false, http.StatusInternalServerError, err
+	}
+	return true, http.StatusOK, nil
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/redact"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gorilla/mux"
+)
+
+const (
+	LATEST string = "latest"
+)
+
+// ReportVersionsHandler - handler that lists the s3 versions of a report object (newest first)
+// the bucket is versioned so every time the bot reprocesses a report the earlier result is kept
+func ReportVersionsHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	var servisbotRequest *schema.ServisBOTRequest
+	addHeaders(w, r)
+
+	// ensure we don't have nil - it will cause a null pointer exception
+	if r.Body == nil {
+		r.Body = ioutil.NopCloser(bytes.NewBufferString(""))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "ReportVersionsHandler body data %v"
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	con.TraceBody("ReportVersionsHandler request body : %s", body)
+
+	errs := json.Unmarshal(body, &servisbotRequest)
+	if errs != nil {
+		msg := "ReportVersionsHandler could not unmarshal input data from servisBOT to schema %v"
+		con.Error(msg, errs)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, errs)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// check the jwt token
+	_, err = verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
+	if err != nil {
+		msg := "ReportVersionsHandler verifyToken  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	key, _, code, err := reportKey(con, servisbotRequest)
+	if err != nil {
+		msg := "ReportVersionsHandler %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	versions, err := objectVersions(con, os.Getenv(AWSBUCKET), key)
+	if err != nil {
+		msg := "ReportVersionsHandler %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(objectErrorCode(err), w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	response := &schema.VersionsResponse{Code: http.StatusOK, Status: "OK", Message: fmt.Sprintf("ReportVersionsHandler found %d versions", len(versions)), Id: servisbotRequest.Data.Id, Versions: versions}
+	w.WriteHeader(http.StatusOK)
+	b, _ := json.MarshalIndent(response, "", "	")
+	fmt.Fprintf(w, string(b))
+	return
+}
+
+// ReportVersionHandler - handler that gets a specific s3 version of a report object (redacted as in ReportObjectHandler)
+func ReportVersionHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	var servisbotRequest *schema.ServisBOTRequest
+	addHeaders(w, r)
+	vars := mux.Vars(r)
+
+	// ensure we don't have nil - it will cause a null pointer exception
+	if r.Body == nil {
+		r.Body = ioutil.NopCloser(bytes.NewBufferString(""))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "ReportVersionHandler body data %v"
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	con.TraceBody("ReportVersionHandler request body : %s", body)
+
+	errs := json.Unmarshal(body, &servisbotRequest)
+	if errs != nil {
+		msg := "ReportVersionHandler could not unmarshal input data from servisBOT to schema %v"
+		con.Error(msg, errs)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, errs)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// check the jwt token
+	creds, err := verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
+	if err != nil {
+		msg := "ReportVersionHandler verifyToken  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	unmasked, code, err := checkUnmask(con, creds, servisbotRequest, "ReportContent")
+	if err != nil {
+		msg := "ReportVersionHandler unmask %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	data, cas, code, err := reportVersion(con, servisbotRequest, vars["version"])
+	if err != nil {
+		msg := "ReportVersionHandler %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	if !unmasked {
+		data = redact.Get().Report(creds.Role, data)
+	}
+
+	response := &schema.ReportResponse{Code: http.StatusOK, Status: "OK", Message: "ReportVersionHandler s3 object version call successful", Cas: cas, Report: *data}
+	w.WriteHeader(http.StatusOK)
+	b, _ := json.MarshalIndent(response, "", "	")
+	fmt.Fprintf(w, string(b))
+	return
+}
+
+// ReportDiffHandler - handler that returns the field level changes between two s3 versions of a report object
+// both versions are redacted (unless unmasked) before they are compared so the diff never shows pii
+func ReportDiffHandler(w http.ResponseWriter, r *http.Request, con connectors.Clients) {
+	var servisbotRequest *schema.ServisBOTRequest
+	addHeaders(w, r)
+	vars := mux.Vars(r)
+
+	// ensure we don't have nil - it will cause a null pointer exception
+	if r.Body == nil {
+		r.Body = ioutil.NopCloser(bytes.NewBufferString(""))
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "ReportDiffHandler body data %v"
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	con.TraceBody("ReportDiffHandler request body : %s", body)
+
+	errs := json.Unmarshal(body, &servisbotRequest)
+	if errs != nil {
+		msg := "ReportDiffHandler could not unmarshal input data from servisBOT to schema %v"
+		con.Error(msg, errs)
+		b := responseErrorFormat(http.StatusInternalServerError, w, msg, errs)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	// check the jwt token
+	creds, err := verifyJwtToken(r.Context(), servisbotRequest.JwtToken)
+	if err != nil {
+		msg := "ReportDiffHandler verifyToken  %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(http.StatusForbidden, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	unmasked, code, err := checkUnmask(con, creds, servisbotRequest, "ReportDiff")
+	if err != nil {
+		msg := "ReportDiffHandler unmask %v"
+		con.Error(msg, err)
+		b := responseErrorFormat(code, w, msg, err)
+		fmt.Fprintf(w, string(b))
+		return
+	}
+
+	var reports []*schema.ReportContent
+	for _, version := range []string{vars["from"], vars["to"]} {
+		data, _, code, err := reportVersion(con, servisbotRequest, version)
+		if err != nil {
+			msg := "ReportDiffHandler %v"
+			con.Error(msg, err)
+			b := responseErrorFormat(code, w, msg, err)
+			fmt.Fprintf(w, string(b))
+			return
+		}
+		if !unmasked {
+			data = redact.Get().Report(creds.Role, data)
+		}
+		reports = append(reports, data)
+	}
+
+	changes := reports[0].Diff(reports[1])
+	response := &schema.DiffResponse{Code: http.StatusOK, Status: "OK", Message: fmt.Sprintf("ReportDiffHandler found %d changed fields", len(changes)), Id: servisbotRequest.Data.Id, From: vars["from"], To: vars["to"], Changes: changes}
+	w.WriteHeader(http.StatusOK)
+	b, _ := json.MarshalIndent(response, "", "	")
+	fmt.Fprintf(w, string(b))
+	return
+}
+
+// reportVersion - private function, gets a version of the report object from s3 (latest is the current version)
+func reportVersion(con connectors.Clients, servisbotRequest *schema.ServisBOTRequest, version string) (*schema.ReportContent, schema.Cas, int, error) {
+	if version == "" {
+		return nil, 0, http.StatusBadRequest, fmt.Errorf("version is mandatory (use %s for the current version)", LATEST)
+	}
+	bucket := os.Getenv(AWSBUCKET)
+	key, cas, code, err := reportKey(con, servisbotRequest)
+	if err != nil {
+		return nil, cas, code, err
+	}
+
+	opts := &s3.GetObjectInput{Bucket: &bucket, Key: &key}
+	if version != LATEST {
+		opts.VersionId = &version
+	}
+	data, err := con.GetObject(opts)
+	if err != nil {
+		return nil, cas, objectErrorCode(err), err
+	}
+	return data, cas, http.StatusOK, nil
+}
+
+// objectVersions - private function, returns all the versions (and delete markers) of the key, newest first
+// the versions are listed by prefix so the versions of other keys with the same prefix are skipped
+func objectVersions(con connectors.Clients, bucket string, key string) ([]schema.ObjectVersion, error) {
+	var versions []schema.ObjectVersion
+	input := &s3.ListObjectVersionsInput{Bucket: &bucket, Prefix: &key}
+	for {
+		out, err := con.ListObjectVersions(input)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range out.Versions {
+			if aws.StringValue(v.Key) == key {
+				versions = append(versions, schema.ObjectVersion{VersionId: aws.StringValue(v.VersionId), LastModified: unixMillis(v.LastModified), Size: aws.Int64Value(v.Size), IsLatest: aws.BoolValue(v.IsLatest)})
+			}
+		}
+		for _, d := range out.DeleteMarkers {
+			if aws.StringValue(d.Key) == key {
+				versions = append(versions, schema.ObjectVersion{VersionId: aws.StringValue(d.VersionId), LastModified: unixMillis(d.LastModified), IsLatest: aws.BoolValue(d.IsLatest), Deleted: true})
+			}
+		}
+		if !aws.BoolValue(out.IsTruncated) {
+			break
+		}
+		input.KeyMarker, input.VersionIdMarker = out.NextKeyMarker, out.NextVersionIdMarker
+	}
+	if len(versions) == 0 {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "The specified key has no versions.", nil)
+	}
+	sort.SliceStable(versions, func(i, j int) bool { return versions[i].LastModified > versions[j].LastModified })
+	return versions, nil
+}
+
+// objectErrorCode - private function, maps a missing object (or version) to 404 and any other s3 error to 500
+func objectErrorCode(err error) int {
+	if aerr, ok := err.(awserr.Error); ok && (aerr.Code() == s3.ErrCodeNoSuchKey || aerr.Code() == "NoSuchVersion" || aerr.Code() == "NotFound") {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// unixMillis - private function, the time in milliseconds (the report timestamp unit), 0 when not set
+func unixMillis(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.UnixNano() / int64(time.Millisecond)
+}
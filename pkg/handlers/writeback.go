@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/connectors"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	gocb "github.com/couchbase/gocb/v2"
+)
+
+const (
+	WRITEBACKRETRIES string = "WRITEBACK_RETRIES"
+	WRITEBACK        string = "WriteBack"
+)
+
+// writeBackBackoff - the delay before the first retry (doubled on each retry), a var so that tests can shorten it
+var writeBackBackoff = 200 * time.Millisecond
+
+// writeBack - private function, writes the reviewed copy of the report (original plus reviewer labels) to the report bucket
+// the retraining jobs read s3 and not couchbase, the write-back is skipped if AWS_REPORT_BUCKET is not set
+// errors are logged (and dead-lettered for replay) as the reclassification itself has already succeeded
+func writeBack(con connectors.Clients, creds *schema.Credentials, id string, current schema.ListObject, changes map[string]string) {
+	reportBucket := os.Getenv(AWSREPORTBUCKET)
+	if len(changes) == 0 || reportBucket == "" {
+		return
+	}
+
+	prefix, err := channelPrefix(current.Channel)
+	if err != nil {
+		con.Error("Function writeBack %s %v", id, err)
+		return
+	}
+	bucket := os.Getenv(AWSBUCKET)
+	key := prefix + id
+	data, err := con.GetObject(&s3.GetObjectInput{Bucket: &bucket, Key: &key})
+	if err != nil {
+		writeBackDeadLetter(con, reportBucket, key, nil, err)
+		return
+	}
+
+	review := schema.ReviewAnnotation{
+		UserClassification: current.UserClassification,
+		ReviewerNotes:      current.ReviewerNotes,
+		ReviewedBy:         creds.User,
+		ReviewedAt:         time.Now().UnixNano() / int64(time.Millisecond),
+		SourceBucket:       bucket,
+		SourceKey:          key,
+	}
+	if value, ok := changes["UserClassification"]; ok {
+		review.UserClassification = value
+	}
+	if value, ok := changes["ReviewerNotes"]; ok {
+		review.ReviewerNotes = value
+	}
+	annotated := &schema.AnnotatedReport{ReportContent: *data, Review: review}
+	annotated.UserClassification = review.UserClassification
+
+	err = putWithRetry(con, reportBucket, key, annotated, envInt(WRITEBACKRETRIES, 3))
+	if err != nil {
+		writeBackDeadLetter(con, reportBucket, key, annotated, err)
+		return
+	}
+	con.Debug("Function writeBack %s written to %s", key, reportBucket)
+}
+
+// putWithRetry - private function, uploads the report (a put is atomic, the md5 rejects a corrupted upload)
+// failed uploads are retried with an exponential backoff
+func putWithRetry(con connectors.Clients, bucket string, key string, annotated *schema.AnnotatedReport, retries int) error {
+	b, err := json.Marshal(annotated)
+	if err != nil {
+		return err
+	}
+	sum := md5.Sum(b)
+	checksum := base64.StdEncoding.EncodeToString(sum[:])
+	metadata := map[string]*string{
+		"reviewed-by":         aws.String(annotated.Review.ReviewedBy),
+		"reviewed-at":         aws.String(strconv.FormatInt(annotated.Review.ReviewedAt, 10)),
+		"user-classification": aws.String(annotated.Review.UserClassification),
+	}
+
+	if retries < 1 {
+		retries = 1
+	}
+	for attempt := 0; attempt < retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(writeBackBackoff << uint(attempt-1))
+		}
+		// a new reader for each attempt (the previous one has been read)
+		input := &s3.PutObjectInput{
+			Bucket:      &bucket,
+			Key:         &key,
+			Body:        bytes.NewReader(b),
+			ContentType: aws.String("application/json"),
+			ContentMD5:  &checksum,
+			Metadata:    metadata,
+		}
+		_, err = con.PutObject(input)
+		if err == nil {
+			return nil
+		}
+		con.Error("Function putWithRetry %s attempt %d of %d %v", key, attempt+1, retries, err)
+	}
+	return err
+}
+
+// writeBackDeadLetter - private function, stores the failed write-back (with the annotated report if there is one) for replay
+func writeBackDeadLetter(con connectors.Clients, bucket string, key string, annotated *schema.AnnotatedReport, cause error) {
+	con.Error("Function writeBack %s %v", key, cause)
+	now := time.Now()
+	dl := &schema.DeadLetter{
+		Id:        fmt.Sprintf("deadletter::writeback::%s::%d", key, now.UnixNano()),
+		Bucket:    bucket,
+		Key:       key,
+		EventName: WRITEBACK,
+		Error:     cause.Error(),
+		Timestamp: now.UnixNano() / int64(time.Millisecond),
+		Report:    annotated,
+	}
+	_, err := con.Insert(DEADLETTERBUCKET, dl.Id, dl, &gocb.InsertOptions{})
+	if err != nil {
+		con.Error("Function writeBackDeadLetter (insert) couchbase %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+	gocb "github.com/couchbase/gocb/v2"
+)
+
+// deadLetterConnectors - records the dead-lettered write-backs
+type deadLetterConnectors struct {
+	*FakeConnectors
+	letters []*schema.DeadLetter
+}
+
+func (c *deadLetterConnectors) Insert(bucket string, uuid string, value interface{}, opts *gocb.InsertOptions) (*gocb.MutationResult, error) {
+	if dl, ok := value.(*schema.DeadLetter); ok && bucket == DEADLETTERBUCKET {
+		c.letters = append(c.letters, dl)
+	}
+	return c.FakeConnectors.Insert(bucket, uuid, value, opts)
+}
+
+// TestWriteBack - report write-back test entry point
+func TestWriteBack(t *testing.T) {
+
+	logger := &logging.Logger{Level: "trace"}
+	creds := &schema.Credentials{User: "reviewer@test.com"}
+	current := schema.ListObject{UserClassification: "Other", Channel: "Email"}
+	changes := map[string]string{"UserClassification": "Cancel", "ReviewerNotes": "confirmed"}
+	writeBackBackoff = time.Millisecond
+	os.Setenv("AWS_REPORT_BUCKET", "servisbotreports")
+	defer os.Unsetenv("AWS_REPORT_BUCKET")
+
+	t.Run("writeBack : should pass", func(t *testing.T) {
+		conn := &deadLetterConnectors{FakeConnectors: &FakeConnectors{Logger: logger, Flag: "false"}}
+		writeBack(conn, creds, "test", current, changes)
+		if len(conn.Written) != 1 || conn.Written[0] != "Email/test" || len(conn.letters) != 0 {
+			t.Errorf(fmt.Sprintf("Function %s did not write the report - got (%v %d) wanted (%s %d)", "writeBack", conn.Written, len(conn.letters), "Email/test", 0))
+		}
+	})
+
+	t.Run("writeBack : should pass (skipped when nothing changed or no report bucket)", func(t *testing.T) {
+		conn := &deadLetterConnectors{FakeConnectors: &FakeConnectors{Logger: logger, Flag: "false"}}
+		writeBack(conn, creds, "test", current, map[string]string{})
+		os.Unsetenv("AWS_REPORT_BUCKET")
+		writeBack(conn, creds, "test", current, changes)
+		os.Setenv("AWS_REPORT_BUCKET", "servisbotreports")
+		if conn.Puts != 0 {
+			t.Errorf(fmt.Sprintf("Function %s wrote the report - got (%d) wanted (%d)", "writeBack", conn.Puts, 0))
+		}
+	})
+
+	t.Run("writeBack : should pass (failed put is retried)", func(t *testing.T) {
+		conn := &deadLetterConnectors{FakeConnectors: &FakeConnectors{Logger: logger, Flag: "retry"}}
+		writeBack(conn, creds, "test", current, changes)
+		if conn.Puts != 2 || len(conn.Written) != 1 || len(conn.letters) != 0 {
+			t.Errorf(fmt.Sprintf("Function %s did not retry the put - got (%d %v) wanted (%d %s)", "writeBack", conn.Puts, conn.Written, 2, "Email/test"))
+		}
+	})
+
+	t.Run("writeBack : should fail (retries exhausted are dead-lettered)", func(t *testing.T) {
+		os.Setenv("WRITEBACK_RETRIES", "4")
+		defer os.Unsetenv("WRITEBACK_RETRIES")
+		conn := &deadLetterConnectors{FakeConnectors: &FakeConnectors{Logger: logger, Flag: "put"}}
+		writeBack(conn, creds, "test", current, changes)
+		if conn.Puts != 4 || len(conn.letters) != 1 {
+			t.Fatalf(fmt.Sprintf("Function %s did not dead-letter the write-back - got (%d %d) wanted (%d %d)", "writeBack", conn.Puts, len(conn.letters), 4, 1))
+		}
+		dl := conn.letters[0]
+		if dl.EventName != WRITEBACK || dl.Bucket != "servisbotreports" || !strings.HasPrefix(dl.Id, "deadletter::writeback::Email/test") {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect dead letter - got (%s %s %s) wanted (%s %s)", "writeBack", dl.Id, dl.Bucket, dl.EventName, WRITEBACK, "servisbotreports"))
+		}
+		if dl.Report == nil || dl.Report.UserClassification != "Cancel" || dl.Report.Review.UserClassification != "Cancel" || dl.Report.Review.ReviewerNotes != "confirmed" || dl.Report.Review.ReviewedBy != "reviewer@test.com" || dl.Report.Review.SourceKey != "Email/test" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect annotated report - got (%v) wanted (%s)", "writeBack", dl.Report, "Cancel confirmed"))
+		}
+	})
+
+	t.Run("writeBack : should fail (original report not found)", func(t *testing.T) {
+		conn := &deadLetterConnectors{FakeConnectors: &FakeConnectors{Logger: logger, Flag: "nosuchkey"}}
+		writeBack(conn, creds, "test", current, changes)
+		if conn.Puts != 0 || len(conn.letters) != 1 || conn.letters[0].Report != nil {
+			t.Errorf(fmt.Sprintf("Function %s did not dead-letter the missing report - got (%d %d) wanted (%d %d)", "writeBack", conn.Puts, len(conn.letters), 0, 1))
+		}
+	})
+}
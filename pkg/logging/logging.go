@@ -0,0 +1,202 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	TRACE string = "trace"
+	DEBUG string = "debug"
+	INFO  string = "info"
+	WARN  string = "warn"
+	ERROR string = "error"
+
+	REQUESTID     string = "requestId"
+	XREQUESTID    string = "X-Request-ID"
+	MAXREQUESTID  int    = 128
+	REQUESTIDSIZE int    = 16
+)
+
+// the level order, an unknown level logs as info
+var levels = map[string]int{TRACE: 0, DEBUG: 1, INFO: 2, WARN: 3, ERROR: 4}
+
+// writes from all loggers (and their children) are serialized so json lines never interleave
+var mu sync.Mutex
+
+// runtimeLevel - set with SetLevel, overrides the level of every logger ("" uses the logger's own level)
+var runtimeLevel atomic.Value
+
+type contextKey string
+
+// field - a key value pair added to every line (kept in the order it was added)
+type field struct {
+	key   string
+	value interface{}
+}
+
+// Logger - structured levelled logger, each line is a json object with the time, level, msg and the logger fields
+// it has the same methods (and level names) as microlib/simple so it can be used in the same way
+// the zero value logs at info level to stderr
+type Logger struct {
+	Level  string
+	Out    io.Writer
+	fields []field
+}
+
+// With - returns a child logger that adds the field to every line (i.e the request id)
+func (l *Logger) With(key string, value interface{}) *Logger {
+	child := &Logger{Level: l.Level, Out: l.Out, fields: make([]field, len(l.fields), len(l.fields)+1)}
+	copy(child.fields, l.fields)
+	child.fields = append(child.fields, field{key: key, value: value})
+	return child
+}
+
+// Enabled - true if lines of the level are written
+func (l *Logger) Enabled(level string) bool {
+	return rank(level) >= rank(l.CurrentLevel())
+}
+
+// CurrentLevel - the level in use (the runtime level if one is set)
+func (l *Logger) CurrentLevel() string {
+	if level, _ := runtimeLevel.Load().(string); level != "" {
+		return level
+	}
+	return l.Level
+}
+
+// SetLevel - changes the level of every logger at runtime (i.e from the admin listener), "" restores the configured levels
+func SetLevel(level string) error {
+	if _, ok := levels[level]; !ok && level != "" {
+		return fmt.Errorf("unknown log level %s (use trace, debug, info, warn or error)", level)
+	}
+	runtimeLevel.Store(level)
+	return nil
+}
+
+// Error - error level log (always written)
+func (l *Logger) Error(message string) {
+	l.write(ERROR, message)
+}
+
+// Warn - warn level log
+func (l *Logger) Warn(message string) {
+	l.write(WARN, message)
+}
+
+// Info - info level log
+func (l *Logger) Info(message string) {
+	l.write(INFO, message)
+}
+
+// Debug - debug level log
+func (l *Logger) Debug(message string) {
+	l.write(DEBUG, message)
+}
+
+// Trace - trace level log
+func (l *Logger) Trace(message string) {
+	l.write(TRACE, message)
+}
+
+// write - private function, marshals and writes a single line
+func (l *Logger) write(level string, message string) {
+	if !l.Enabled(level) {
+		return
+	}
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	appendValue(&buf, time.Now().UTC().Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	appendValue(&buf, level)
+	buf.WriteString(`,"msg":`)
+	appendValue(&buf, message)
+	for _, f := range l.fields {
+		buf.WriteByte(',')
+		appendValue(&buf, f.key)
+		buf.WriteByte(':')
+		appendValue(&buf, f.value)
+	}
+	buf.WriteString("}\n")
+
+	out := l.Out
+	if out == nil {
+		out = os.Stderr
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	out.Write(buf.Bytes())
+}
+
+// appendValue - private function, a value that can't be marshalled is written as its error
+func appendValue(buf *bytes.Buffer, value interface{}) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		b, _ = json.Marshal(err.Error())
+	}
+	buf.Write(b)
+}
+
+// rank - private function, the order of the level
+func rank(level string) int {
+	if r, ok := levels[level]; ok {
+		return r
+	}
+	return levels[INFO]
+}
+
+// WithRequestID - returns a copy of the context with the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey(REQUESTID), id)
+}
+
+// RequestID - the request id in the context ("" if there is none)
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey(REQUESTID)).(string)
+	return id
+}
+
+// NewRequestID - a random (hex) request id
+func NewRequestID() string {
+	b := make([]byte, REQUESTIDSIZE)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Middleware - honours (or generates) the X-Request-ID header, puts it in the request context and echoes it in the response
+// an invalid id (too long or with characters that could forge log lines) is replaced
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(XREQUESTID)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(XREQUESTID, id)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+	})
+}
+
+// validRequestID - private function, letters, digits and - _ . : only
+func validRequestID(id string) bool {
+	if id == "" || len(id) > MAXREQUESTID {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
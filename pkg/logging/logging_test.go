@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// lines - test helper, decodes each json line
+func lines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &m); err != nil {
+			t.Fatalf(fmt.Sprintf("Line is not json - got (%s) error (%v)", line, err))
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// TestLogging - test entry point
+func TestLogging(t *testing.T) {
+
+	t.Run("Logger : should pass (json line with fields)", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := &Logger{Level: TRACE, Out: &buf}
+		logger.With(REQUESTID, "abc-123").With("user", "test").Info("quoted \"message\"\nnext line")
+		got := lines(t, &buf)
+		if len(got) != 1 || got[0]["level"] != INFO || got[0]["msg"] != "quoted \"message\"\nnext line" || got[0][REQUESTID] != "abc-123" || got[0]["user"] != "test" || got[0]["time"] == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect line - got (%v) wanted (%s)", "Info", got, "requestId abc-123"))
+		}
+	})
+
+	t.Run("Logger : should pass (levels are filtered, the parent has no child fields)", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := &Logger{Level: INFO, Out: &buf}
+		logger.With("child", true)
+		logger.Trace("trace")
+		logger.Debug("debug")
+		logger.Info("info")
+		logger.Warn("warn")
+		logger.Error("error")
+		got := lines(t, &buf)
+		if len(got) != 3 || got[0]["msg"] != "info" || got[2]["level"] != ERROR || got[0]["child"] != nil {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect lines - got (%v) wanted (%s)", "Logger", got, "info warn error"))
+		}
+	})
+
+	t.Run("Logger : should pass (unknown level is info)", func(t *testing.T) {
+		logger := &Logger{Level: "verbose"}
+		if logger.Enabled(DEBUG) || !logger.Enabled(INFO) {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect levels - got (%v %v) wanted (%v %v)", "Enabled", logger.Enabled(DEBUG), logger.Enabled(INFO), false, true))
+		}
+	})
+
+	t.Run("SetLevel : should pass (overrides every logger until cleared)", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := &Logger{Level: INFO, Out: &buf}
+		child := logger.With(REQUESTID, "abc-123")
+		if err := SetLevel(DEBUG); err != nil {
+			t.Fatalf(fmt.Sprintf("Function %s returned an error - got (%v) wanted (%v)", "SetLevel", err, nil))
+		}
+		child.Debug("debug")
+		SetLevel("")
+		child.Debug("hidden")
+		got := lines(t, &buf)
+		if len(got) != 1 || got[0]["msg"] != "debug" || logger.CurrentLevel() != INFO {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect lines - got (%v %s) wanted (%s)", "SetLevel", got, logger.CurrentLevel(), "debug only"))
+		}
+	})
+
+	t.Run("SetLevel : should fail (unknown level)", func(t *testing.T) {
+		if err := SetLevel("verbose"); err == nil {
+			t.Errorf(fmt.Sprintf("Function %s did not return an error - got (%v) wanted (%s)", "SetLevel", err, "error"))
+		}
+	})
+
+	t.Run("Middleware : should pass (honours a valid request id)", func(t *testing.T) {
+		var seen string
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			seen = RequestID(r.Context())
+		}))
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set(XREQUESTID, "upstream-42")
+		handler.ServeHTTP(rr, req)
+		if seen != "upstream-42" || rr.Header().Get(XREQUESTID) != "upstream-42" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect request id - got (%s %s) wanted (%s)", "Middleware", seen, rr.Header().Get(XREQUESTID), "upstream-42"))
+		}
+	})
+
+	t.Run("Middleware : should pass (generates a request id, invalid ids are replaced)", func(t *testing.T) {
+		for _, header := range []string{"", "forged\n{\"level\":\"error\"}", strings.Repeat("a", MAXREQUESTID+1)} {
+			var seen string
+			handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestID(r.Context())
+			}))
+			rr := httptest.NewRecorder()
+			req, _ := http.NewRequest("GET", "/", nil)
+			req.Header.Set(XREQUESTID, header)
+			handler.ServeHTTP(rr, req)
+			if len(seen) != 2*REQUESTIDSIZE || seen == header || rr.Header().Get(XREQUESTID) != seen {
+				t.Errorf(fmt.Sprintf("Function %s returned incorrect request id - got (%s %s) wanted (%s)", "Middleware", seen, rr.Header().Get(XREQUESTID), "generated"))
+			}
+		}
+	})
+}
@@ -0,0 +1,154 @@
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	HTTPBUCKETS    string = "HTTP_DURATION_BUCKETS"
+	BACKENDBUCKETS string = "BACKEND_DURATION_BUCKETS"
+	OK             string = "ok"
+	ERROR          string = "error"
+)
+
+// DefaultBackendBuckets - backend calls are (mostly) faster than a request so the buckets start lower
+var DefaultBackendBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests by route (template), method and status code.",
+	}, []string{"route", "method", "status"})
+
+	// the histograms are replaced (with the configured buckets) by Init
+	mu              sync.RWMutex
+	httpDuration    = register(newHTTPDuration(prometheus.DefBuckets))
+	backendDuration = register(newBackendDuration(DefaultBackendBuckets))
+)
+
+// newHTTPDuration - private function
+func newHTTPDuration(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Duration of HTTP requests by route (template), method and status code.",
+		Buckets: buckets,
+	}, []string{"route", "method", "status"})
+}
+
+// newBackendDuration - private function
+func newBackendDuration(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "backend_request_duration_seconds",
+		Help:    "Duration of backend (s3, couchbase and n1ql) calls by operation and result (ok or error).",
+		Buckets: buckets,
+	}, []string{"backend", "operation", "result"})
+}
+
+// register - private function
+func register(h *prometheus.HistogramVec) *prometheus.HistogramVec {
+	prometheus.MustRegister(h)
+	return h
+}
+
+// Init - sets the histogram buckets from HTTP_DURATION_BUCKETS and BACKEND_DURATION_BUCKETS (comma separated seconds)
+// the prometheus defaults are used for the requests and DefaultBackendBuckets for the backend calls when they are not set
+func Init(logger *logging.Logger) error {
+	httpBuckets, err := Buckets(os.Getenv(HTTPBUCKETS), prometheus.DefBuckets)
+	if err != nil {
+		err = fmt.Errorf("%s %v", HTTPBUCKETS, err)
+		logger.Error(fmt.Sprintf("Metrics : %v", err))
+		return err
+	}
+	backendBuckets, err := Buckets(os.Getenv(BACKENDBUCKETS), DefaultBackendBuckets)
+	if err != nil {
+		err = fmt.Errorf("%s %v", BACKENDBUCKETS, err)
+		logger.Error(fmt.Sprintf("Metrics : %v", err))
+		return err
+	}
+	SetBuckets(httpBuckets, backendBuckets)
+	logger.Info(fmt.Sprintf("Metrics : http buckets %v backend buckets %v", httpBuckets, backendBuckets))
+	return nil
+}
+
+// Buckets - parses a comma separated list of (increasing, positive) bucket bounds, the default is returned for ""
+func Buckets(value string, def []float64) ([]float64, error) {
+	if strings.TrimSpace(value) == "" {
+		return def, nil
+	}
+	var buckets []float64
+	for _, field := range strings.Split(value, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || b <= 0 {
+			return nil, fmt.Errorf("bucket (%s) must be a positive number of seconds", field)
+		}
+		if len(buckets) > 0 && b <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("buckets must be increasing (%s)", value)
+		}
+		buckets = append(buckets, b)
+	}
+	return buckets, nil
+}
+
+// SetBuckets - replaces the histograms (the samples observed so far are dropped)
+func SetBuckets(httpBuckets []float64, backendBuckets []float64) {
+	mu.Lock()
+	defer mu.Unlock()
+	prometheus.Unregister(httpDuration)
+	prometheus.Unregister(backendDuration)
+	httpDuration = register(newHTTPDuration(httpBuckets))
+	backendDuration = register(newBackendDuration(backendBuckets))
+}
+
+// ObserveBackend - records the duration of a backend call
+func ObserveBackend(backend string, operation string, duration time.Duration, err error) {
+	result := OK
+	if err != nil {
+		result = ERROR
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	backendDuration.WithLabelValues(backend, operation, result).Observe(duration.Seconds())
+}
+
+// statusWriter - private type, keeps the response status for the labels
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusWriter) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware - counts and times each request by route template (not the path, so ids don't create new series), method and status
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r)
+
+		status := strconv.Itoa(sw.status)
+		httpRequests.WithLabelValues(route, r.Method, status).Inc()
+		mu.RLock()
+		defer mu.RUnlock()
+		httpDuration.WithLabelValues(route, r.Method, status).Observe(time.Since(start).Seconds())
+	})
+}
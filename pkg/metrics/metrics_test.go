@@ -0,0 +1,104 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// upperBounds - test helper, the bucket bounds of a histogram series
+func upperBounds(t *testing.T, h *prometheus.HistogramVec, labels ...string) []float64 {
+	var m dto.Metric
+	if err := h.WithLabelValues(labels...).(prometheus.Metric).Write(&m); err != nil {
+		t.Fatalf(fmt.Sprintf("Histogram could not be written - got (%v)", err))
+	}
+	var bounds []float64
+	for _, b := range m.GetHistogram().GetBucket() {
+		bounds = append(bounds, b.GetUpperBound())
+	}
+	return bounds
+}
+
+// TestMetrics - test entry point
+func TestMetrics(t *testing.T) {
+
+	logger := &logging.Logger{Level: "trace"}
+
+	t.Run("Buckets : should pass", func(t *testing.T) {
+		buckets, err := Buckets(" 0.05, 0.1,1 ", prometheus.DefBuckets)
+		if err != nil || !reflect.DeepEqual(buckets, []float64{0.05, 0.1, 1}) {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect buckets - got (%v %v) wanted (%v)", "Buckets", buckets, err, "0.05 0.1 1"))
+		}
+		buckets, err = Buckets("", DefaultBackendBuckets)
+		if err != nil || !reflect.DeepEqual(buckets, DefaultBackendBuckets) {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect buckets - got (%v %v) wanted (%v)", "Buckets", buckets, err, DefaultBackendBuckets))
+		}
+	})
+
+	t.Run("Buckets : should fail (not a number, not positive, not increasing)", func(t *testing.T) {
+		for _, value := range []string{"0.1,fast", "0,1", "1,0.5", "1,1"} {
+			if _, err := Buckets(value, nil); err == nil {
+				t.Errorf(fmt.Sprintf("Function %s did not return an error for (%s) - got (%v) wanted (%s)", "Buckets", value, err, "error"))
+			}
+		}
+	})
+
+	t.Run("Init : should pass (configured buckets)", func(t *testing.T) {
+		os.Setenv(HTTPBUCKETS, "0.1,0.5,2")
+		os.Setenv(BACKENDBUCKETS, "0.01,0.1")
+		defer os.Unsetenv(HTTPBUCKETS)
+		defer os.Unsetenv(BACKENDBUCKETS)
+		if err := Init(logger); err != nil {
+			t.Fatalf(fmt.Sprintf("Function %s returned an error - got (%v) wanted (%v)", "Init", err, nil))
+		}
+		if got := upperBounds(t, httpDuration, "/", "GET", "200"); !reflect.DeepEqual(got, []float64{0.1, 0.5, 2}) {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect http buckets - got (%v) wanted (%v)", "Init", got, "0.1 0.5 2"))
+		}
+		if got := upperBounds(t, backendDuration, "s3", "GetObject", OK); !reflect.DeepEqual(got, []float64{0.01, 0.1}) {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect backend buckets - got (%v) wanted (%v)", "Init", got, "0.01 0.1"))
+		}
+		SetBuckets(prometheus.DefBuckets, DefaultBackendBuckets)
+	})
+
+	t.Run("Init : should fail (invalid buckets)", func(t *testing.T) {
+		os.Setenv(BACKENDBUCKETS, "slow")
+		defer os.Unsetenv(BACKENDBUCKETS)
+		if err := Init(logger); err == nil {
+			t.Errorf(fmt.Sprintf("Function %s did not return an error - got (%v) wanted (%s)", "Init", err, "error"))
+		}
+	})
+
+	t.Run("Middleware : should pass (counted by route template, method and status)", func(t *testing.T) {
+		r := mux.NewRouter()
+		r.Use(Middleware)
+		r.HandleFunc("/api/v1/reports/{id}", func(w http.ResponseWriter, req *http.Request) {
+			w.WriteHeader(http.StatusConflict)
+		})
+		for _, id := range []string{"1", "2"} {
+			req, _ := http.NewRequest("PATCH", "/api/v1/reports/"+id, nil)
+			r.ServeHTTP(httptest.NewRecorder(), req)
+		}
+		if got := testutil.ToFloat64(httpRequests.WithLabelValues("/api/v1/reports/{id}", "PATCH", "409")); got != 2 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect count - got (%v) wanted (%d)", "Middleware", got, 2))
+		}
+	})
+
+	t.Run("ObserveBackend : should pass (labelled by result)", func(t *testing.T) {
+		ObserveBackend("n1ql", "GetList", 5*time.Millisecond, nil)
+		ObserveBackend("n1ql", "GetList", time.Millisecond, errors.New("timeout"))
+		if testutil.CollectAndCount(backendDuration) != 2 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect series - got (%d) wanted (%d)", "ObserveBackend", testutil.CollectAndCount(backendDuration), 2))
+		}
+	})
+}
@@ -0,0 +1,373 @@
+package redact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+)
+
+const (
+	REDACTIONRULESFILE string = "REDACTION_RULES_FILE"
+	NONE               string = "none"
+	MASK               string = "mask"
+	PARTIAL            string = "partial"
+	TEXT               string = "text"
+	MASKED             string = "****"
+	TRACEBODYLIMIT     string = "TRACE_BODY_LIMIT"
+	MAXTRACEBODY       int    = 1 << 20
+	JWTTOKEN           string = "jwttoken"
+)
+
+// ErrUnmaskDenied - returned when the caller's role is not allowed to unmask
+var ErrUnmaskDenied = errors.New("role is not allowed to unmask")
+
+// emailPattern - used by the partial action (keeps the first character and the domain)
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// Rules - the redaction action per field for each role
+// free text fields (and all log lines) are redacted with the named patterns
+// the trace fields (at any depth, any case) are masked when a request body is logged, the jwt token always is
+type Rules struct {
+	Default  string                       `json:"default"`
+	Unmask   []string                     `json:"unmask"`
+	Patterns map[string]string            `json:"patterns"`
+	Roles    map[string]map[string]string `json:"roles"`
+	Trace    []string                     `json:"trace,omitempty"`
+	compiled []pattern
+	traced   map[string]bool
+}
+
+type pattern struct {
+	name string
+	re   *regexp.Regexp
+}
+
+var current = Default()
+
+// defaultTrace - the request body fields masked when a rules file doesn't set them
+var defaultTrace = []string{"password", "EmailAddress", "EmailRecipient", "EmailBody", "CustomerInfo", "CustomerNumber", "ReviewerNotes", "Chat", "Form"}
+
+// traceLimit - the maximum size of a logged request body (TRACE_BODY_LIMIT, 0 is unlimited)
+var traceLimit = 4096
+
+// Default - the built in rules (used when no REDACTION_RULES_FILE is set)
+// every role is treated as a reviewer and only admin can unmask
+func Default() *Rules {
+	r := &Rules{
+		Default: "reviewer",
+		Unmask:  []string{"admin"},
+		Patterns: map[string]string{
+			"email":          emailPattern.String(),
+			// customer numbers are 12 digits zero padded (a plain run of digits could be a timestamp or a counter)
+			"customernumber": `\b0\d{11}\b`,
+			"phone":          `\+\d[\d ().\-]{7,}\d`,
+		},
+		Roles: map[string]map[string]string{
+			"reviewer": {
+				"EmailAddress":   PARTIAL,
+				"EmailRecipient": PARTIAL,
+				"EmailSubject":   TEXT,
+				"EmailBody":      TEXT,
+				"CustomerInfo":   PARTIAL,
+				"Chat":           TEXT,
+				"Form":           TEXT,
+			},
+		},
+		Trace: defaultTrace,
+	}
+	r.Validate()
+	return r
+}
+
+// Init - loads the rules from REDACTION_RULES_FILE (if set) and makes them the current rules
+func Init(logger *logging.Logger) error {
+	if limit := os.Getenv(TRACEBODYLIMIT); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			err = fmt.Errorf("%s must be a positive number of bytes (%s)", TRACEBODYLIMIT, limit)
+			logger.Error(fmt.Sprintf("Redaction rules : %v", err))
+			return err
+		}
+		traceLimit = n
+	}
+
+	path := os.Getenv(REDACTIONRULESFILE)
+	if path == "" {
+		logger.Info("Redaction rules : using built in default")
+		return nil
+	}
+	r, err := Load(path)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Redaction rules : %v", err))
+		return err
+	}
+	logger.Info(fmt.Sprintf("Redaction rules : loaded from %s", path))
+	Set(r)
+	return nil
+}
+
+// Load - reads and validates a rules json file
+func Load(path string) (*Rules, error) {
+	var r *Rules
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &r)
+	if err != nil {
+		return nil, err
+	}
+	err = r.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Get - returns the current rules
+func Get() *Rules {
+	return current
+}
+
+// Set - replaces the current rules
+func Set(r *Rules) {
+	current = r
+}
+
+// Validate - the default role must exist, every action must be known and every pattern must compile
+func (r *Rules) Validate() error {
+	if _, ok := r.Roles[r.Default]; !ok {
+		return fmt.Errorf("default role %q has no rules", r.Default)
+	}
+	for role, fields := range r.Roles {
+		for field, action := range fields {
+			switch action {
+			case NONE, MASK, PARTIAL, TEXT:
+			default:
+				return fmt.Errorf("role %s field %s has unknown action %s", role, field, action)
+			}
+		}
+	}
+
+	var names []string
+	for name := range r.Patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	r.compiled = nil
+	for _, name := range names {
+		re, err := regexp.Compile(r.Patterns[name])
+		if err != nil {
+			return fmt.Errorf("pattern %s %v", name, err)
+		}
+		r.compiled = append(r.compiled, pattern{name: name, re: re})
+	}
+
+	if r.Trace == nil {
+		r.Trace = defaultTrace
+	}
+	r.traced = map[string]bool{JWTTOKEN: true}
+	for _, field := range r.Trace {
+		r.traced[strings.ToLower(field)] = true
+	}
+	return nil
+}
+
+// For - returns the field actions for the role (unknown roles get the default role)
+func (r *Rules) For(role string) map[string]string {
+	if fields, ok := r.Roles[role]; ok {
+		return fields
+	}
+	return r.Roles[r.Default]
+}
+
+// CanUnmask - reports if the role is allowed to see unredacted content
+func (r *Rules) CanUnmask(role string) bool {
+	for _, u := range r.Unmask {
+		if u == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Text - replaces every pattern match (emails are partially masked)
+func (r *Rules) Text(s string) string {
+	for _, p := range r.compiled {
+		if p.name == "email" {
+			s = p.re.ReplaceAllStringFunc(s, maskEmail)
+			continue
+		}
+		s = p.re.ReplaceAllString(s, "[redacted:"+p.name+"]")
+	}
+	return s
+}
+
+// Value - applies the action to a single value
+func (r *Rules) Value(action string, s string) string {
+	if s == "" {
+		return s
+	}
+	switch action {
+	case MASK:
+		return MASKED
+	case PARTIAL:
+		if emailPattern.MatchString(s) {
+			return emailPattern.ReplaceAllStringFunc(s, maskEmail)
+		}
+		if len(s) > 4 {
+			return strings.Repeat("*", len(s)-4) + s[len(s)-4:]
+		}
+		return MASKED
+	case TEXT:
+		return r.Text(s)
+	}
+	return s
+}
+
+// Report - returns a redacted copy of the report content for the role
+func (r *Rules) Report(role string, rc *schema.ReportContent) *schema.ReportContent {
+	fields := r.For(role)
+	out := *rc
+	out.EmailAdress = r.Value(fields["EmailAddress"], rc.EmailAdress)
+	out.EmailRecipient = r.Value(fields["EmailRecipient"], rc.EmailRecipient)
+	out.EmailSubject = r.Value(fields["EmailSubject"], rc.EmailSubject)
+	out.EmailBody = r.Value(fields["EmailBody"], rc.EmailBody)
+	out.CustomerInfo.CustomerNumber = r.Value(fields["CustomerInfo"], rc.CustomerInfo.CustomerNumber)
+	out.CustomerInfo.SubRef = r.Value(fields["CustomerInfo"], rc.CustomerInfo.SubRef)
+	if fields["CustomerInfo"] != "" && fields["CustomerInfo"] != NONE {
+		out.CustomerInfo.Message = r.Text(rc.CustomerInfo.Message)
+	}
+	if rc.Chat != nil {
+		chat := *rc.Chat
+		chat.Messages = make([]schema.ChatMessage, len(rc.Chat.Messages))
+		for i, m := range rc.Chat.Messages {
+			m.Text = r.Value(fields["Chat"], m.Text)
+			chat.Messages[i] = m
+		}
+		out.Chat = &chat
+	}
+	if rc.Form != nil {
+		form := *rc.Form
+		form.Fields = make(map[string]string, len(rc.Form.Fields))
+		for k, v := range rc.Form.Fields {
+			form.Fields[k] = r.Value(fields["Form"], v)
+		}
+		out.Form = &form
+	}
+	return &out
+}
+
+// List - returns a redacted copy of the list row for the role (the summary fields follow the report content rules)
+func (r *Rules) List(role string, lo schema.ListObject) schema.ListObject {
+	fields := r.For(role)
+	lo.Sender = r.Value(fields["EmailAddress"], lo.Sender)
+	lo.Subject = r.Value(fields["EmailSubject"], lo.Subject)
+	lo.Preview = r.Value(fields["EmailBody"], lo.Preview)
+	lo.CustomerNumber = r.Value(fields["CustomerInfo"], lo.CustomerNumber)
+	return lo
+}
+
+// Email - returns a redacted copy of the parsed email for the role
+// the email fields follow the report content rules (From is the EmailAddress, To/Cc the EmailRecipient)
+func (r *Rules) Email(role string, v *schema.EmailView) *schema.EmailView {
+	fields := r.For(role)
+	out := *v
+	out.From = r.Value(fields["EmailAddress"], v.From)
+	out.To = r.Value(fields["EmailRecipient"], v.To)
+	out.Cc = r.Value(fields["EmailRecipient"], v.Cc)
+	out.Subject = r.Value(fields["EmailSubject"], v.Subject)
+	out.Text = r.Value(fields["EmailBody"], v.Text)
+	out.Html = r.Value(fields["EmailBody"], v.Html)
+
+	headers := map[string]string{
+		"From":         fields["EmailAddress"],
+		"Reply-To":     fields["EmailAddress"],
+		"Return-Path":  fields["EmailAddress"],
+		"Sender":       fields["EmailAddress"],
+		"To":           fields["EmailRecipient"],
+		"Cc":           fields["EmailRecipient"],
+		"Delivered-To": fields["EmailRecipient"],
+		"Subject":      fields["EmailSubject"],
+	}
+	out.Headers = make(map[string][]string, len(v.Headers))
+	for name, values := range v.Headers {
+		// any other header (i.e Received) can still carry addresses
+		action, ok := headers[name]
+		if !ok && fields["EmailAddress"] != "" && fields["EmailAddress"] != NONE {
+			action = TEXT
+		}
+		for _, value := range values {
+			out.Headers[name] = append(out.Headers[name], r.Value(action, value))
+		}
+	}
+	return &out
+}
+
+// Log - redacts a log line with the current rules
+func Log(s string) string {
+	return current.Text(s)
+}
+
+// Body - a request body for the trace log with the current rules and limit
+func Body(body []byte) string {
+	return current.Body(body, traceLimit)
+}
+
+// Body - masks the trace fields of the json body, redacts the rest as text and caps the size
+// bodies that are not json (or too large to parse) are not logged, only their size
+func (r *Rules) Body(body []byte, limit int) string {
+	if len(body) > MAXTRACEBODY {
+		return fmt.Sprintf("[%d bytes not logged]", len(body))
+	}
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return fmt.Sprintf("[%d bytes not json]", len(body))
+	}
+	b, _ := json.Marshal(r.maskBody(v))
+	s := r.Text(string(b))
+	if limit > 0 && len(s) > limit {
+		s = fmt.Sprintf("%s...[truncated %d bytes]", strings.ToValidUTF8(s[:limit], ""), len(s)-limit)
+	}
+	return s
+}
+
+// maskBody - private function, replaces the (non empty) values of the trace fields at any depth
+func (r *Rules) maskBody(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, value := range t {
+			if r.traced[strings.ToLower(k)] && value != nil && value != "" {
+				t[k] = MASKED
+				continue
+			}
+			t[k] = r.maskBody(value)
+		}
+	case []interface{}:
+		for i, value := range t {
+			t[i] = r.maskBody(value)
+		}
+	}
+	return v
+}
+
+// maskEmail - private function, keeps the first character of the local part and the domain
+func maskEmail(s string) string {
+	at := strings.LastIndex(s, "@")
+	if at < 1 {
+		return MASKED
+	}
+	return s[:1] + "***" + s[at:]
+}
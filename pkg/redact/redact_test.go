@@ -0,0 +1,190 @@
+package redact
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/schema"
+)
+
+// TestRedact - test entry point
+func TestRedact(t *testing.T) {
+	logger := &logging.Logger{Level: "trace"}
+
+	t.Run("Text : should pass (default patterns)", func(t *testing.T) {
+		got := Default().Text("contact mariner@example.com or +1 (555) 010-9999 about customer 000119944160")
+		want := "contact m***@example.com or [redacted:phone] about customer [redacted:customernumber]"
+		if got != want {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect text - got (%s) wanted (%s)", "Text", got, want))
+		}
+	})
+
+	t.Run("Text : should pass (timestamps and counters are not customer numbers)", func(t *testing.T) {
+		in := "sent at 1597144108 (1597144108220 ms) after 123456789 retries"
+		if got := Default().Text(in); got != in {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect text - got (%s) wanted (%s)", "Text", got, in))
+		}
+	})
+
+	t.Run("Value : should pass (all actions)", func(t *testing.T) {
+		r := Default()
+		for _, tc := range []struct{ action, in, want string }{
+			{NONE, "Test@test.com", "Test@test.com"},
+			{"", "Test@test.com", "Test@test.com"},
+			{MASK, "Test@test.com", MASKED},
+			{PARTIAL, "\"Mariner\" <mariner@example.com>", "\"Mariner\" <m***@example.com>"},
+			{PARTIAL, "000119944160", "********4160"},
+			{PARTIAL, "abc", MASKED},
+			{MASK, "", ""},
+		} {
+			if got := r.Value(tc.action, tc.in); got != tc.want {
+				t.Errorf(fmt.Sprintf("Function %s returned incorrect value for (%s %s) - got (%s) wanted (%s)", "Value", tc.action, tc.in, got, tc.want))
+			}
+		}
+	})
+
+	t.Run("Report : should pass (copy is redacted, original is untouched)", func(t *testing.T) {
+		rc := &schema.ReportContent{
+			EmailAdress:  "Test@test.com",
+			EmailBody:    "my number is 000119944160",
+			CustomerInfo: schema.CustomerDetail{CustomerNumber: "000119944160", Message: "mail me at Test@test.com"},
+			Chat:         &schema.ChatTranscript{Messages: []schema.ChatMessage{{From: "customer", Text: "I am Test@test.com"}}},
+			Form:         &schema.FormSubmission{Fields: map[string]string{"email": "Test@test.com"}},
+		}
+		got := Default().Report("unknown-role", rc)
+		if got.EmailAdress != "T***@test.com" || got.CustomerInfo.CustomerNumber != "********4160" || got.EmailBody != "my number is [redacted:customernumber]" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect fields - got (%v)", "Report", got))
+		}
+		if got.CustomerInfo.Message != "mail me at T***@test.com" || got.Chat.Messages[0].Text != "I am T***@test.com" || got.Form.Fields["email"] != "T***@test.com" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect free text - got (%v %v %v)", "Report", got.CustomerInfo, got.Chat, got.Form))
+		}
+		if rc.EmailAdress != "Test@test.com" || rc.Chat.Messages[0].Text != "I am Test@test.com" || rc.Form.Fields["email"] != "Test@test.com" {
+			t.Errorf(fmt.Sprintf("Function %s modified the original - got (%v)", "Report", rc))
+		}
+	})
+
+	t.Run("List : should pass (summary fields are redacted)", func(t *testing.T) {
+		lo := schema.ListObject{Sender: "Test@test.com", Subject: "call +353 1 234 5678", CustomerNumber: "000119944160", Preview: "my number is 000119944160", UserClassification: "Cancel"}
+		got := Default().List("reviewer", lo)
+		want := schema.ListObject{Sender: "T***@test.com", Subject: "call [redacted:phone]", CustomerNumber: "********4160", Preview: "my number is [redacted:customernumber]", UserClassification: "Cancel"}
+		if got != want {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect fields - got (%v) wanted (%v)", "List", got, want))
+		}
+	})
+
+	t.Run("Email : should pass (headers are redacted)", func(t *testing.T) {
+		v := &schema.EmailView{
+			From:    "\"Mariner\" <mariner@example.com>",
+			To:      "mail@greenzonestocks.pubsvs.com",
+			Text:    "call +1 555 010 9999",
+			Headers: map[string][]string{"From": {"\"Mariner\" <mariner@example.com>"}, "Received": {"from mx by mariner@example.com"}, "Message-Id": {"<1@mg>"}},
+		}
+		got := Default().Email("reviewer", v)
+		if got.From != "\"Mariner\" <m***@example.com>" || got.To != "m***@greenzonestocks.pubsvs.com" || got.Text != "call [redacted:phone]" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect fields - got (%v)", "Email", got))
+		}
+		if got.Headers["From"][0] != got.From || strings.Contains(got.Headers["Received"][0], "mariner@") || got.Headers["Message-Id"][0] != "<1@mg>" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect headers - got (%v)", "Email", got.Headers))
+		}
+	})
+
+	t.Run("Body : should pass (jwt and trace fields are masked at any depth)", func(t *testing.T) {
+		body := `{"jwtToken": "eyJhbGciOiJIUzI1NiJ9.e30.sig", "data": {"id": "test", "servisbotstats": {"reviewerNotes": "called Test@test.com", "UserClassification": "Cancel"}}, "items": [{"Password": "secret", "count": 12}], "note": "mail Test@test.com"}`
+		got := Default().Body([]byte(body), 0)
+		for _, leaked := range []string{"eyJhbGciOiJIUzI1NiJ9", "called", "secret", "Test@test.com"} {
+			if strings.Contains(got, leaked) {
+				t.Errorf(fmt.Sprintf("Function %s leaked (%s) - got (%s)", "Body", leaked, got))
+			}
+		}
+		for _, kept := range []string{`"jwtToken":"****"`, `"reviewerNotes":"****"`, `"UserClassification":"Cancel"`, `"count":12`, `"note":"mail T***@test.com"`} {
+			if !strings.Contains(got, kept) {
+				t.Errorf(fmt.Sprintf("Function %s returned incorrect body - got (%s) wanted (%s)", "Body", got, kept))
+			}
+		}
+	})
+
+	t.Run("Body : should pass (size is capped, not json is not logged)", func(t *testing.T) {
+		r := Default()
+		if got := r.Body([]byte(`{"id": "`+strings.Repeat("a", 100)+`"}`), 20); got != `{"id":"aaaaaaaaaaaaa...[truncated 89 bytes]` {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect capped body - got (%s)", "Body", got))
+		}
+		if got := r.Body([]byte("jwtToken=eyJhbGciOiJIUzI1NiJ9"), 0); got != "[29 bytes not json]" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect body - got (%s) wanted (%s)", "Body", got, "[29 bytes not json]"))
+		}
+		if got := r.Body(make([]byte, MAXTRACEBODY+1), 0); !strings.Contains(got, "not logged") {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect body - got (%s) wanted (%s)", "Body", got, "not logged"))
+		}
+	})
+
+	t.Run("Load : should pass (per role rules)", func(t *testing.T) {
+		r, err := Load("../../tests/redaction-rules.json")
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Function %s returned with error - got (%v) wanted (%v)", "Load", err, nil))
+		}
+		rc := &schema.ReportContent{EmailAdress: "Test@test.com", EmailBody: "from Test@test.com"}
+		if got := r.Report("reviewer", rc); got.EmailAdress != MASKED || got.EmailBody != "from T***@test.com" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect fields for reviewer - got (%v)", "Report", got))
+		}
+		if got := r.Report("supervisor", rc); got.EmailAdress != "T***@test.com" || got.EmailBody != rc.EmailBody {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect fields for supervisor - got (%v)", "Report", got))
+		}
+		if !r.CanUnmask("supervisor") || r.CanUnmask("reviewer") || r.CanUnmask("") {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect result", "CanUnmask"))
+		}
+	})
+
+	t.Run("Load : should fail (unknown action)", func(t *testing.T) {
+		_, err := Load("../../tests/redaction-rules-invalid.json")
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Load", err, "error"))
+		}
+	})
+
+	t.Run("Load : should fail (no file)", func(t *testing.T) {
+		_, err := Load("../../tests/does-not-exist.json")
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Load", err, "error"))
+		}
+	})
+
+	t.Run("Init : should pass (rules file)", func(t *testing.T) {
+		os.Setenv(REDACTIONRULESFILE, "../../tests/redaction-rules.json")
+		err := Init(logger)
+		if err != nil || !Get().CanUnmask("supervisor") {
+			t.Errorf(fmt.Sprintf("Function %s returned with error - got (%v) wanted (%v)", "Init", err, nil))
+		}
+		if got := Log("user Test@test.com"); got != "user T***@test.com" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect line - got (%s)", "Log", got))
+		}
+		Set(Default())
+		os.Unsetenv(REDACTIONRULESFILE)
+	})
+
+	t.Run("Init : should fail (invalid trace body limit)", func(t *testing.T) {
+		os.Setenv(TRACEBODYLIMIT, "-1")
+		if err := Init(logger); err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Init", err, "error"))
+		}
+		os.Setenv(TRACEBODYLIMIT, "1024")
+		if err := Init(logger); err != nil || traceLimit != 1024 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect limit - got (%v %d) wanted (%d)", "Init", err, traceLimit, 1024))
+		}
+		os.Unsetenv(TRACEBODYLIMIT)
+		traceLimit = 4096
+	})
+
+	t.Run("Init : should fail (invalid rules file)", func(t *testing.T) {
+		os.Setenv(REDACTIONRULESFILE, "../../tests/redaction-rules-invalid.json")
+		err := Init(logger)
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Init", err, "error"))
+		}
+		os.Unsetenv(REDACTIONRULESFILE)
+		if err = Init(logger); err != nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with error - got (%v) wanted (%v)", "Init", err, nil))
+		}
+	})
+}
@@ -1,10 +1,59 @@
 package schema
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	CHANNELEMAIL   string = "Email"
+	CHANNELWEBFORM string = "WebForm"
+	CHANNELCHAT    string = "Chat"
+	PREVIEWLENGTH  int    = 160
+)
+
+// Cas - the couchbase cas version token, it is sent as a json string
+// real cas values are above 2^53 so a js client would round a json number (and every update would then conflict)
+// a json number is still accepted when reading (the n1ql results and older clients)
+type Cas uint64
+
+// MarshalJSON - the cas as a decimal string
+func (c Cas) MarshalJSON() ([]byte, error) {
+	return json.Marshal(strconv.FormatUint(uint64(c), 10))
+}
+
+// UnmarshalJSON - the cas from a decimal string or a json number (null or "" is no cas)
+func (c *Cas) UnmarshalJSON(b []byte) error {
+	value := string(b)
+	if value == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+	if value == "" {
+		*c = 0
+		return nil
+	}
+	cas, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("cas %s is not a version token", b)
+	}
+	*c = Cas(cas)
+	return nil
+}
+
 // Response schema
 type Response struct {
 	Code    int          `json:"code"`
 	Status  string       `json:"status"`
 	Message string       `json:"message"`
+	Cas     Cas          `json:"cas,omitempty"`
 	Reports []ReportList `json:"reports,omitempty"`
 }
 
@@ -29,9 +78,184 @@ type ReportResponse struct {
 	Code    int           `json:"code"`
 	Status  string        `json:"status"`
 	Message string        `json:"message"`
+	Cas     Cas           `json:"cas,omitempty"`
 	Report  ReportContent `json:"report,omitempty"`
 }
 
+// BatchResponse schema - a result per requested report (partial success is allowed)
+type BatchResponse struct {
+	Code    int           `json:"code"`
+	Status  string        `json:"status"`
+	Message string        `json:"message"`
+	Results []BatchResult `json:"results,omitempty"`
+}
+
+// AuditResponse schema
+type AuditResponse struct {
+	Code    int           `json:"code"`
+	Status  string        `json:"status"`
+	Message string        `json:"message"`
+	Records []AuditRecord `json:"records,omitempty"`
+}
+
+// BulkResponse schema
+type BulkResponse struct {
+	Code    int          `json:"code"`
+	Status  string       `json:"status"`
+	Message string       `json:"message"`
+	Results []BulkResult `json:"results,omitempty"`
+}
+
+// LabelsResponse schema - the label taxonomy for an affiliate (used for the UI dropdowns)
+type LabelsResponse struct {
+	Code      int               `json:"code"`
+	Status    string            `json:"status"`
+	Message   string            `json:"message"`
+	Affiliate string            `json:"affiliate,omitempty"`
+	Labels    []string          `json:"labels"`
+	Aliases   map[string]string `json:"aliases,omitempty"`
+}
+
+// EmailResponse schema
+type EmailResponse struct {
+	Code    int        `json:"code"`
+	Status  string     `json:"status"`
+	Message string     `json:"message"`
+	Email   *EmailView `json:"email,omitempty"`
+}
+
+// PresignResponse schema
+type PresignResponse struct {
+	Code      int    `json:"code"`
+	Status    string `json:"status"`
+	Message   string `json:"message"`
+	Expires   int64  `json:"expires,omitempty"`
+	ReportUrl string `json:"reporturl,omitempty"`
+	EmailUrl  string `json:"emailurl,omitempty"`
+}
+
+// VersionsResponse schema - the s3 versions of a report (newest first)
+type VersionsResponse struct {
+	Code     int             `json:"code"`
+	Status   string          `json:"status"`
+	Message  string          `json:"message"`
+	Id       string          `json:"id,omitempty"`
+	Versions []ObjectVersion `json:"versions,omitempty"`
+}
+
+// ObjectVersion schema - a deleted version is an s3 delete marker (it has no content)
+type ObjectVersion struct {
+	VersionId    string `json:"versionId"`
+	LastModified int64  `json:"lastModified"`
+	Size         int64  `json:"size"`
+	IsLatest     bool   `json:"isLatest"`
+	Deleted      bool   `json:"deleted,omitempty"`
+}
+
+// DiffResponse schema - the field level changes between two versions of a report
+type DiffResponse struct {
+	Code    int           `json:"code"`
+	Status  string        `json:"status"`
+	Message string        `json:"message"`
+	Id      string        `json:"id,omitempty"`
+	From    string        `json:"from,omitempty"`
+	To      string        `json:"to,omitempty"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// FieldChange schema - the field is the json path (i.e CustomerInfo.customerNumber)
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// SNSMessage schema - the envelope of an sns http(s) notification
+type SNSMessage struct {
+	Type         string `json:"Type"`
+	MessageId    string `json:"MessageId"`
+	TopicArn     string `json:"TopicArn"`
+	Message      string `json:"Message"`
+	SubscribeURL string `json:"SubscribeURL"`
+}
+
+// S3Event schema - an s3 event notification (only the fields we use)
+type S3Event struct {
+	Event   string          `json:"Event,omitempty"`
+	Records []S3EventRecord `json:"Records"`
+}
+
+// S3EventRecord schema
+type S3EventRecord struct {
+	EventName string `json:"eventName"`
+	EventTime string `json:"eventTime"`
+	S3        struct {
+		Bucket struct {
+			Name string `json:"name"`
+		} `json:"bucket"`
+		Object struct {
+			Key  string `json:"key"`
+			Size int64  `json:"size"`
+		} `json:"object"`
+	} `json:"s3"`
+}
+
+// IngestResponse schema
+type IngestResponse struct {
+	Code    int            `json:"code"`
+	Status  string         `json:"status"`
+	Message string         `json:"message"`
+	Results []IngestResult `json:"results,omitempty"`
+}
+
+// IngestResult schema - the outcome of each event record
+type IngestResult struct {
+	Key     string `json:"key"`
+	Id      string `json:"id,omitempty"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// DeadLetter schema - a failed ingestion event, report write-back or audit record insert (kept for replay)
+type DeadLetter struct {
+	Id        string           `json:"id"`
+	Bucket    string           `json:"bucket"`
+	Key       string           `json:"key"`
+	EventName string           `json:"eventName"`
+	Error     string           `json:"error"`
+	Timestamp int64            `json:"timestamp"`
+	Record    S3EventRecord    `json:"record"`
+	Report    *AnnotatedReport `json:"report,omitempty"`
+	Audit     *AuditRecord     `json:"audit,omitempty"`
+}
+
+// ReconcileReport schema - the drift found (and repaired) between the s3 report bucket and couchbase
+type ReconcileReport struct {
+	DryRun           bool     `json:"dryRun"`
+	Started          int64    `json:"started"`
+	Finished         int64    `json:"finished"`
+	Objects          int      `json:"objects"`
+	Documents        int      `json:"documents"`
+	MissingDocuments []string `json:"missingDocuments"`
+	MissingObjects   []string `json:"missingObjects"`
+	Repaired         int      `json:"repaired"`
+	Skipped          int      `json:"skipped"`
+	Failed           int      `json:"failed"`
+}
+
+// BackfillReport schema - the progress of a backfill (also used as the checkpoint)
+type BackfillReport struct {
+	Bucket     string `json:"bucket"`
+	Prefix     string `json:"prefix"`
+	StartAfter string `json:"startAfter"`
+	Objects    int    `json:"objects"`
+	Inserted   int    `json:"inserted"`
+	Updated    int    `json:"updated"`
+	Failed     int    `json:"failed"`
+	Started    int64  `json:"started"`
+	Finished   int64  `json:"finished,omitempty"`
+}
+
 // GenericSchema - used in the GenericHandler (complex data object)
 type GenericSchema struct {
 	Token   string
@@ -51,32 +275,302 @@ type Credentials struct {
 	User           string `json:"user"`
 	Password       string `json:"password"`
 	CustomerNumber string `json:"customerNumber"`
+	Role           string `json:"role,omitempty"`
 }
 
 type ServisBOTRequest struct {
+	JwtToken string                 `json:"jwtToken"`
+	Data     ReportList             `json:"data,omitempty"`
+	Patch    map[string]interface{} `json:"patch,omitempty"`
+	Unmask   bool                   `json:"unmask,omitempty"`
+}
+
+// BulkRequest schema - reclassify many reports in one call
+// if atomic is set the items are applied in one couchbase transaction, either all items are committed or none are
+type BulkRequest struct {
 	JwtToken string     `json:"jwtToken"`
-	Data     ReportList `json:"data,omitempty"`
+	Atomic   bool       `json:"atomic"`
+	Items    []BulkItem `json:"items"`
+}
+
+// BulkItem schema
+type BulkItem struct {
+	Id                 string `json:"id"`
+	Cas                Cas    `json:"cas"`
+	UserClassification string `json:"UserClassification"`
+}
+
+// BulkResult schema - the outcome of each bulk item
+type BulkResult struct {
+	Id      string `json:"id"`
+	Code    int    `json:"code"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	Cas     Cas    `json:"cas,omitempty"`
+}
+
+// BatchRequest schema - fetch many report objects in one call
+type BatchRequest struct {
+	JwtToken string   `json:"jwtToken"`
+	Ids      []string `json:"ids"`
+	Unmask   bool     `json:"unmask,omitempty"`
+}
+
+// BatchResult schema - the report (or the error) for each requested id
+type BatchResult struct {
+	Id      string         `json:"id"`
+	Code    int            `json:"code"`
+	Status  string         `json:"status"`
+	Message string         `json:"message,omitempty"`
+	Cas     Cas            `json:"cas,omitempty"`
+	Report  *ReportContent `json:"report,omitempty"`
+}
+
+// BrowseRequest schema - a page of the s3 listing of the report (source) bucket or the write-back (report) bucket
+// from and to (milliseconds) filter on the object last modified time
+type BrowseRequest struct {
+	JwtToken          string `json:"jwtToken"`
+	Bucket            string `json:"bucket,omitempty"`
+	Prefix            string `json:"prefix,omitempty"`
+	Delimiter         string `json:"delimiter,omitempty"`
+	StartAfter        string `json:"startAfter,omitempty"`
+	ContinuationToken string `json:"continuationToken,omitempty"`
+	MaxKeys           int64  `json:"maxKeys,omitempty"`
+	From              int64  `json:"from,omitempty"`
+	To                int64  `json:"to,omitempty"`
+}
+
+// BrowseObject schema - a listed object, indexed is set when the report has a servisbotstats document
+type BrowseObject struct {
+	Key          string `json:"key"`
+	Id           string `json:"id,omitempty"`
+	Size         int64  `json:"size"`
+	LastModified int64  `json:"lastModified"`
+	Indexed      bool   `json:"indexed"`
+}
+
+// BrowseResponse schema
+type BrowseResponse struct {
+	Code      int            `json:"code,omitempty"`
+	Status    string         `json:"status"`
+	Message   string         `json:"message"`
+	Bucket    string         `json:"bucket"`
+	Prefix    string         `json:"prefix"`
+	Objects   []BrowseObject `json:"objects"`
+	Prefixes  []string       `json:"prefixes,omitempty"`
+	NextToken string         `json:"nextToken,omitempty"`
 }
 
 // ReportContent schema
 type ReportContent struct {
-	Channel             string         `json:"Channel"`
-	Affiliate           string         `json:"Affiliate"`
-	MessageID           string         `json:"MessageId"`
-	EmailBody           string         `json:"EmailBody"`
-	EmailSubject        string         `json:"EmailSubject"`
-	EmailAdress         string         `json:"EmailAddress"`
-	EmailRecipient      string         `json:"EmailRecipient"`
-	EmailS3Key          string         `json:"EmailS3Key"`
-	Timestamp           int64          `json:"Timestamp"`
-	Endpoint            interface{}    `json:"Endpoint"`
-	BotProcessingMode   string         `json:"BotProcessingMode"`
-	ProcessOutcome      string         `json:"ProcessOutcome"`
-	Entities            []string       `json:"Entities"`
-	EmailClassification string         `json:"EmailClassification"`
-	UserClassification  string         `json:"UserClassification"`
-	Success             bool           `json:"Success"`
-	CustomerInfo        CustomerDetail `json:"CustomerInfo"`
+	Channel             string          `json:"Channel"`
+	Affiliate           string          `json:"Affiliate"`
+	MessageID           string          `json:"MessageId"`
+	EmailBody           string          `json:"EmailBody"`
+	EmailSubject        string          `json:"EmailSubject"`
+	EmailAdress         string          `json:"EmailAddress"`
+	EmailRecipient      string          `json:"EmailRecipient"`
+	EmailS3Key          string          `json:"EmailS3Key"`
+	Timestamp           int64           `json:"Timestamp"`
+	Endpoint            interface{}     `json:"Endpoint"`
+	BotProcessingMode   string          `json:"BotProcessingMode"`
+	ProcessOutcome      string          `json:"ProcessOutcome"`
+	Entities            []string        `json:"Entities"`
+	EmailClassification string          `json:"EmailClassification"`
+	UserClassification  string          `json:"UserClassification"`
+	Success             bool            `json:"Success"`
+	CustomerInfo        CustomerDetail  `json:"CustomerInfo"`
+	Chat                *ChatTranscript `json:"Chat,omitempty"`
+	Form                *FormSubmission `json:"Form,omitempty"`
+}
+
+// AnnotatedReport schema - the reviewed copy of a report written back to the report bucket (read by the retraining jobs)
+// the report fields stay at the top level so the copy can be read in the same way as the original
+type AnnotatedReport struct {
+	ReportContent
+	Review ReviewAnnotation `json:"Review"`
+}
+
+// ReviewAnnotation schema - the reviewer labels and the source of the original report
+type ReviewAnnotation struct {
+	UserClassification string `json:"UserClassification"`
+	ReviewerNotes      string `json:"ReviewerNotes,omitempty"`
+	ReviewedBy         string `json:"ReviewedBy"`
+	ReviewedAt         int64  `json:"ReviewedAt"`
+	SourceBucket       string `json:"SourceBucket"`
+	SourceKey          string `json:"SourceKey"`
+}
+
+// Validate - checks that the channel is known and that the channel specific content is set
+// reports without a channel were all emails (before other channels were supported)
+func (rc *ReportContent) Validate() error {
+	switch rc.Channel {
+	case "", CHANNELEMAIL:
+		return nil
+	case CHANNELCHAT:
+		if rc.Chat == nil {
+			return errors.New("chat report has no transcript")
+		}
+		return nil
+	case CHANNELWEBFORM:
+		if rc.Form == nil {
+			return errors.New("web form report has no form fields")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown channel %s", rc.Channel)
+}
+
+// Copy - a deep copy of the report (the nested content and the decoded endpoint are not shared)
+func (rc *ReportContent) Copy() *ReportContent {
+	out := *rc
+	out.Endpoint = copyValue(rc.Endpoint)
+	if rc.Entities != nil {
+		out.Entities = append([]string{}, rc.Entities...)
+	}
+	if rc.Chat != nil {
+		chat := *rc.Chat
+		if rc.Chat.Messages != nil {
+			chat.Messages = append([]ChatMessage{}, rc.Chat.Messages...)
+		}
+		out.Chat = &chat
+	}
+	if rc.Form != nil {
+		form := *rc.Form
+		if rc.Form.Fields != nil {
+			form.Fields = make(map[string]string, len(rc.Form.Fields))
+			for name, value := range rc.Form.Fields {
+				form.Fields[name] = value
+			}
+		}
+		out.Form = &form
+	}
+	return &out
+}
+
+// copyValue - private function, a deep copy of a decoded json value
+func copyValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(t))
+		for k, e := range t {
+			out[k] = copyValue(e)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(t))
+		for i, e := range t {
+			out[i] = copyValue(e)
+		}
+		return out
+	}
+	return v
+}
+
+// Projection - the ListObject (couchbase meta data) for the report
+// the email summary fields are denormalized so that the list can be shown without fetching each report
+func (rc *ReportContent) Projection() ListObject {
+	return ListObject{
+		ProcessOutcome:      rc.ProcessOutcome,
+		EmailClassification: rc.EmailClassification,
+		UserClassification:  rc.UserClassification,
+		Success:             rc.Success,
+		Timestamp:           rc.Timestamp,
+		AffiliateId:         rc.Affiliate,
+		Channel:             rc.Channel,
+		Subject:             rc.EmailSubject,
+		Sender:              rc.EmailAdress,
+		CustomerNumber:      rc.CustomerInfo.CustomerNumber,
+		Preview:             rc.preview(),
+		EmailS3Key:          rc.EmailS3Key,
+	}
+}
+
+// preview - private function, the first PREVIEWLENGTH characters of the channel content (whitespace collapsed)
+func (rc *ReportContent) preview() string {
+	var parts []string
+	switch {
+	case rc.Chat != nil:
+		for _, m := range rc.Chat.Messages {
+			parts = append(parts, m.Text)
+		}
+	case rc.Form != nil:
+		var names []string
+		for name := range rc.Form.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			parts = append(parts, name+": "+rc.Form.Fields[name])
+		}
+	default:
+		parts = append(parts, rc.EmailBody)
+	}
+
+	text := []rune(strings.Join(strings.Fields(strings.Join(parts, " ")), " "))
+	if len(text) > PREVIEWLENGTH {
+		return strings.TrimSpace(string(text[:PREVIEWLENGTH])) + "..."
+	}
+	return string(text)
+}
+
+// Diff - returns the field level changes from this report to the other report (sorted by field)
+// nested objects are compared field by field, lists and values as a whole
+func (rc *ReportContent) Diff(other *ReportContent) []FieldChange {
+	changes := []FieldChange{}
+	diffFields("", contentFields(rc), contentFields(other), &changes)
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// contentFields - private function, the report as a generic json object (the field names are the json names)
+func contentFields(rc *ReportContent) map[string]interface{} {
+	var fields map[string]interface{}
+	b, _ := json.Marshal(rc)
+	json.Unmarshal(b, &fields)
+	return fields
+}
+
+// diffFields - private function, appends the changed fields (a missing field is nil)
+func diffFields(prefix string, old map[string]interface{}, new map[string]interface{}, changes *[]FieldChange) {
+	names := make(map[string]bool)
+	for name := range old {
+		names[name] = true
+	}
+	for name := range new {
+		names[name] = true
+	}
+	for name := range names {
+		om, ook := old[name].(map[string]interface{})
+		nm, nok := new[name].(map[string]interface{})
+		if ook && nok {
+			diffFields(prefix+name+".", om, nm, changes)
+			continue
+		}
+		if !reflect.DeepEqual(old[name], new[name]) {
+			*changes = append(*changes, FieldChange{Field: prefix + name, Old: old[name], New: new[name]})
+		}
+	}
+}
+
+// ChatTranscript schema - the chat channel content
+type ChatTranscript struct {
+	SessionId string        `json:"SessionId"`
+	Messages  []ChatMessage `json:"Messages"`
+}
+
+// ChatMessage schema
+type ChatMessage struct {
+	From      string `json:"From"`
+	Text      string `json:"Text"`
+	Timestamp int64  `json:"Timestamp"`
+}
+
+// FormSubmission schema - the web form channel content
+type FormSubmission struct {
+	FormId string            `json:"FormId"`
+	Url    string            `json:"Url"`
+	Fields map[string]string `json:"Fields"`
 }
 
 type CustomerDetail struct {
@@ -92,6 +586,7 @@ type CustomerDetail struct {
 }
 
 type Stat struct {
+	AffiliateId        string `json:"affiliateid"`
 	ProcessOutcome     string `json:"processoutcome"`
 	UserClassification string `json:"userclassification"`
 	Count              int64  `json:"count"`
@@ -124,9 +619,80 @@ type ListObject struct {
 	Success             bool   `json:"Success"`
 	Timestamp           int64  `json:"Timestamp"`
 	AffiliateId         string `json:"AffiliateId"`
+	Channel             string `json:"Channel,omitempty"`
+	ReviewerNotes       string `json:"ReviewerNotes,omitempty"`
+	Subject             string `json:"Subject,omitempty"`
+	Sender              string `json:"Sender,omitempty"`
+	CustomerNumber      string `json:"CustomerNumber,omitempty"`
+	Preview             string `json:"Preview,omitempty"`
+	EmailS3Key          string `json:"EmailS3Key,omitempty"`
 }
 
+// ReportList schema - the cas field is the couchbase version token used for optimistic concurrency
 type ReportList struct {
 	Id             string     `json:"id"`
+	Cas            Cas        `json:"cas,omitempty"`
 	ServisbotStats ListObject `json:"servisbotstats"`
 }
+
+// AuditRecord schema - immutable record of a change made to a report (written once, never updated)
+type AuditRecord struct {
+	Id             string `json:"id"`
+	Action         string `json:"Action"`
+	ReportId       string `json:"ReportId"`
+	User           string `json:"User"`
+	CustomerNumber string `json:"CustomerNumber"`
+	Timestamp      int64  `json:"Timestamp"`
+	Field          string `json:"Field,omitempty"`
+	OldValue       string `json:"OldValue,omitempty"`
+	NewValue       string `json:"NewValue,omitempty"`
+}
+
+// EmailView schema - structured view of the original (raw mime) email, the html is sanitized
+type EmailView struct {
+	From        string              `json:"from"`
+	To          string              `json:"to"`
+	Cc          string              `json:"cc,omitempty"`
+	Subject     string              `json:"subject"`
+	Date        string              `json:"date"`
+	MessageId   string              `json:"messageId"`
+	Headers     map[string][]string `json:"headers"`
+	Text        string              `json:"text"`
+	Html        string              `json:"html"`
+	Attachments []EmailAttachment   `json:"attachments,omitempty"`
+}
+
+// EmailAttachment schema - the index is used to download the attachment
+type EmailAttachment struct {
+	Index       int    `json:"index"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	ContentId   string `json:"contentId,omitempty"`
+	Size        int    `json:"size"`
+}
+
+// LogLevelRequest schema - the runtime log level change (admin listener)
+type LogLevelRequest struct {
+	Level string `json:"level"`
+}
+
+// AdminResponse schema - the admin listener responses
+type AdminResponse struct {
+	Code    int               `json:"code"`
+	Status  string            `json:"status"`
+	Message string            `json:"message"`
+	Level   string            `json:"level,omitempty"`
+	Build   *BuildInfo        `json:"build,omitempty"`
+	Config  map[string]string `json:"config,omitempty"`
+}
+
+// BuildInfo schema - the service version and the go build settings (the vcs revision when built from git)
+type BuildInfo struct {
+	Name      string `json:"name"`
+	Version   string `json:"version"`
+	GoVersion string `json:"goVersion"`
+	Module    string `json:"module"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
@@ -0,0 +1,108 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestSchema - test entry point
+func TestSchema(t *testing.T) {
+
+	t.Run("Validate : should pass", func(t *testing.T) {
+		reports := []ReportContent{
+			{},
+			{Channel: CHANNELEMAIL},
+			{Channel: CHANNELCHAT, Chat: &ChatTranscript{SessionId: "1234", Messages: []ChatMessage{{From: "customer", Text: "please cancel"}}}},
+			{Channel: CHANNELWEBFORM, Form: &FormSubmission{FormId: "cancel", Fields: map[string]string{"reason": "too expensive"}}},
+		}
+		for _, rc := range reports {
+			if err := rc.Validate(); err != nil {
+				t.Errorf(fmt.Sprintf("Function %s returned with error for channel %q - got (%v) wanted (%v)", "Validate", rc.Channel, err, nil))
+			}
+		}
+	})
+
+	t.Run("Validate : should fail", func(t *testing.T) {
+		reports := []ReportContent{
+			{Channel: "Fax"},
+			{Channel: CHANNELCHAT},
+			{Channel: CHANNELWEBFORM},
+		}
+		for _, rc := range reports {
+			if err := rc.Validate(); err == nil {
+				t.Errorf(fmt.Sprintf("Function %s returned with no error for channel %q - got (%v) wanted (%s)", "Validate", rc.Channel, err, "error"))
+			}
+		}
+	})
+
+	t.Run("Cas : should pass (above 2^53, string and number)", func(t *testing.T) {
+		var CAS Cas = 1700000000000000123
+		b, _ := json.Marshal(&ReportList{Id: "test", Cas: CAS})
+		if !strings.Contains(string(b), `"cas":"1700000000000000123"`) {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect json - got (%s) wanted (%s)", "MarshalJSON", b, "a string cas"))
+		}
+		for _, payload := range []string{`{"cas":"1700000000000000123"}`, `{"cas":1700000000000000123}`} {
+			var rl ReportList
+			if err := json.Unmarshal([]byte(payload), &rl); err != nil || rl.Cas != CAS {
+				t.Errorf(fmt.Sprintf("Function %s returned incorrect cas for %s - got (%d %v) wanted (%d %v)", "UnmarshalJSON", payload, rl.Cas, err, CAS, nil))
+			}
+		}
+		var rl ReportList
+		if err := json.Unmarshal([]byte(`{"cas":null}`), &rl); err != nil || rl.Cas != 0 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect cas for null - got (%d %v) wanted (%d %v)", "UnmarshalJSON", rl.Cas, err, 0, nil))
+		}
+	})
+
+	t.Run("Cas : should fail (not a version token)", func(t *testing.T) {
+		for _, payload := range []string{`{"cas":"abc"}`, `{"cas":-1}`, `{"cas":1.7e18}`, `{"cas":true}`} {
+			var rl ReportList
+			if err := json.Unmarshal([]byte(payload), &rl); err == nil {
+				t.Errorf(fmt.Sprintf("Function %s returned no error for %s - got (%v) wanted (%s)", "UnmarshalJSON", payload, err, "error"))
+			}
+		}
+	})
+
+	t.Run("Projection : should pass", func(t *testing.T) {
+		rc := &ReportContent{Channel: CHANNELEMAIL, Affiliate: "BH-01", ProcessOutcome: "No Action", EmailClassification: "Cancel", Success: true, Timestamp: 1597144108220, EmailAdress: "cduffy@tfd.ie", EmailSubject: "Cancel", EmailBody: "please\n\n  cancel my subscription", CustomerInfo: CustomerDetail{CustomerNumber: "000119944160"}}
+		want := ListObject{ProcessOutcome: "No Action", EmailClassification: "Cancel", Success: true, Timestamp: 1597144108220, AffiliateId: "BH-01", Channel: CHANNELEMAIL, Subject: "Cancel", Sender: "cduffy@tfd.ie", CustomerNumber: "000119944160", Preview: "please cancel my subscription"}
+		if got := rc.Projection(); got != want {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect projection - got (%v) wanted (%v)", "Projection", got, want))
+		}
+	})
+
+	t.Run("Projection : should pass (preview)", func(t *testing.T) {
+		reports := map[string]ReportContent{
+			"customer: please cancel agent: done":      {Channel: CHANNELCHAT, Chat: &ChatTranscript{Messages: []ChatMessage{{From: "customer", Text: "customer: please cancel"}, {From: "agent", Text: "agent: done"}}}},
+			"email: a@b.ie reason: too expensive":      {Channel: CHANNELWEBFORM, Form: &FormSubmission{Fields: map[string]string{"reason": "too expensive", "email": "a@b.ie"}}},
+			strings.Repeat("x", PREVIEWLENGTH) + "...": {Channel: CHANNELEMAIL, EmailBody: strings.Repeat("x", PREVIEWLENGTH+10)},
+		}
+		for want, rc := range reports {
+			if got := rc.Projection().Preview; got != want {
+				t.Errorf(fmt.Sprintf("Function %s returned incorrect preview for channel %q - got (%s) wanted (%s)", "Projection", rc.Channel, got, want))
+			}
+		}
+	})
+
+	t.Run("Diff : should pass", func(t *testing.T) {
+		old := &ReportContent{ProcessOutcome: "No Action", Entities: []string{"a"}, CustomerInfo: CustomerDetail{CustomerNumber: "1"}, Chat: &ChatTranscript{SessionId: "1"}}
+		new := &ReportContent{ProcessOutcome: "Cancel", Entities: []string{"a"}, CustomerInfo: CustomerDetail{CustomerNumber: "2"}}
+		got := old.Diff(new)
+		want := []string{"Chat", "CustomerInfo.customerNumber", "ProcessOutcome"}
+		if len(got) != len(want) {
+			t.Fatalf(fmt.Sprintf("Function %s returned incorrect changes - got (%v) wanted (%v)", "Diff", got, want))
+		}
+		for i := range want {
+			if got[i].Field != want[i] {
+				t.Errorf(fmt.Sprintf("Function %s returned incorrect field - got (%s) wanted (%s)", "Diff", got[i].Field, want[i]))
+			}
+		}
+		if got[2].Old != "No Action" || got[2].New != "Cancel" || got[0].New != nil {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect values - got (%v) wanted (%s)", "Diff", got, "No Action -> Cancel, Chat -> nil"))
+		}
+		if len(old.Diff(old)) != 0 {
+			t.Errorf(fmt.Sprintf("Function %s returned changes for the same report - got (%v) wanted (%s)", "Diff", old.Diff(old), "none"))
+		}
+	})
+}
@@ -0,0 +1,192 @@
+package taxonomy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+)
+
+const (
+	NOACTION          string = "No Action"
+	CANCEL            string = "Cancel Subscription"
+	CANCELAR          string = "Cancel Autorenewal"
+	LABELTAXONOMYFILE string = "LABEL_TAXONOMY_FILE"
+)
+
+// ErrUnknownLabel - returned when a label (or alias) is not part of the taxonomy
+var ErrUnknownLabel = errors.New("unknown label")
+
+// Labels - the canonical labels, the aliases that map to them and the confusion matrix class of the other labels
+type Labels struct {
+	Labels  []string          `json:"labels"`
+	Aliases map[string]string `json:"aliases,omitempty"`
+	Classes map[string]string `json:"classes,omitempty"`
+}
+
+// Classes - the confusion matrix classes (rows and columns of the stats), every label is counted as one of them
+var Classes = []string{NOACTION, CANCEL, CANCELAR}
+
+// Taxonomy - the default labels with optional per affiliate overrides
+type Taxonomy struct {
+	Default    Labels            `json:"default"`
+	Affiliates map[string]Labels `json:"affiliates,omitempty"`
+}
+
+var current = Default()
+
+// Default - the built in taxonomy (used when no LABEL_TAXONOMY_FILE is set)
+func Default() *Taxonomy {
+	return &Taxonomy{
+		Default: Labels{
+			Labels: []string{NOACTION, CANCEL, CANCELAR},
+			Aliases: map[string]string{
+				"NoAction":         NOACTION,
+				"Cancel":           CANCEL,
+				"CancelAR":         CANCELAR,
+				"Cancel AutoRenew": CANCELAR,
+			},
+		},
+	}
+}
+
+// Init - loads the taxonomy from LABEL_TAXONOMY_FILE (if set) and makes it the current taxonomy
+func Init(logger *logging.Logger) error {
+	path := os.Getenv(LABELTAXONOMYFILE)
+	if path == "" {
+		logger.Info("Label taxonomy : using built in default")
+		return nil
+	}
+	t, err := Load(path)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Label taxonomy : %v", err))
+		return err
+	}
+	logger.Info(fmt.Sprintf("Label taxonomy : loaded from %s", path))
+	Set(t)
+	return nil
+}
+
+// Load - reads and validates a taxonomy json file
+func Load(path string) (*Taxonomy, error) {
+	var t *Taxonomy
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &t)
+	if err != nil {
+		return nil, err
+	}
+	err = t.Validate()
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Get - returns the current taxonomy
+func Get() *Taxonomy {
+	return current
+}
+
+// Set - replaces the current taxonomy
+func Set(t *Taxonomy) {
+	current = t
+}
+
+// Validate - every alias must map to a canonical label and every label must have a confusion matrix class
+// a label that is not a class itself needs a classes entry (otherwise its reviews would be missing from the stats)
+func (t *Taxonomy) Validate() error {
+	all := map[string]Labels{"default": t.Default}
+	for affiliate, labels := range t.Affiliates {
+		all[affiliate] = labels
+	}
+	for name, labels := range all {
+		if len(labels.Labels) == 0 {
+			return fmt.Errorf("taxonomy %s has no labels", name)
+		}
+		for alias, label := range labels.Aliases {
+			if !contains(labels.Labels, label) {
+				return fmt.Errorf("taxonomy %s alias %s maps to unknown label %s", name, alias, label)
+			}
+		}
+		for label, class := range labels.Classes {
+			if !contains(labels.Labels, label) {
+				return fmt.Errorf("taxonomy %s class of unknown label %s", name, label)
+			}
+			if !contains(Classes, class) {
+				return fmt.Errorf("taxonomy %s label %s maps to unknown class %s (one of %s)", name, label, class, strings.Join(Classes, ", "))
+			}
+		}
+		for _, label := range labels.Labels {
+			if _, ok := labels.Classes[label]; !ok && !contains(Classes, label) {
+				return fmt.Errorf("taxonomy %s label %s has no class (one of %s)", name, label, strings.Join(Classes, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// For - returns the labels for the affiliate (falling back to the default)
+func (t *Taxonomy) For(affiliate string) Labels {
+	if labels, ok := t.Affiliates[affiliate]; ok {
+		return labels
+	}
+	return t.Default
+}
+
+// Normalize - maps a label or alias (case insensitive) to its canonical label
+// an empty label is valid (the report has not been reviewed)
+func (t *Taxonomy) Normalize(affiliate string, label string) (string, error) {
+	label = strings.TrimSpace(label)
+	if label == "" {
+		return label, nil
+	}
+	labels := t.For(affiliate)
+	for _, l := range labels.Labels {
+		if strings.EqualFold(l, label) {
+			return l, nil
+		}
+	}
+	for alias, l := range labels.Aliases {
+		if strings.EqualFold(alias, label) {
+			return l, nil
+		}
+	}
+	return label, fmt.Errorf("%w %q for affiliate %q", ErrUnknownLabel, label, affiliate)
+}
+
+// Canonical - like Normalize but returns the label as is when it is unknown (used for stats)
+func (t *Taxonomy) Canonical(affiliate string, label string) string {
+	l, _ := t.Normalize(affiliate, label)
+	return l
+}
+
+// Class - the confusion matrix class of a label or alias (empty when the label is unknown)
+func (t *Taxonomy) Class(affiliate string, label string) string {
+	l, err := t.Normalize(affiliate, label)
+	if err != nil {
+		return ""
+	}
+	if class, ok := t.For(affiliate).Classes[l]; ok {
+		return class
+	}
+	if contains(Classes, l) {
+		return l
+	}
+	return ""
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
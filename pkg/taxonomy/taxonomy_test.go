@@ -0,0 +1,104 @@
+package taxonomy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+)
+
+// TestTaxonomy - test entry point
+func TestTaxonomy(t *testing.T) {
+	logger := &logging.Logger{Level: "trace"}
+
+	t.Run("Normalize : should pass (default aliases)", func(t *testing.T) {
+		tx := Default()
+		for in, want := range map[string]string{"Cancel": CANCEL, "cancel subscription": CANCEL, "CancelAR": CANCELAR, "No Action": NOACTION, "": ""} {
+			got, err := tx.Normalize("BH-01", in)
+			if err != nil || got != want {
+				t.Errorf(fmt.Sprintf("Function %s returned incorrect label for %q - got (%s, %v) wanted (%s)", "Normalize", in, got, err, want))
+			}
+		}
+	})
+
+	t.Run("Normalize : should fail (unknown label)", func(t *testing.T) {
+		_, err := Default().Normalize("BH-01", "test")
+		if !errors.Is(err, ErrUnknownLabel) {
+			t.Errorf(fmt.Sprintf("Function %s returned with incorrect error - got (%v) wanted (%v)", "Normalize", err, ErrUnknownLabel))
+		}
+	})
+
+	t.Run("Load : should pass (per affiliate labels)", func(t *testing.T) {
+		tx, err := Load("../../tests/label-taxonomy.json")
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Function %s returned with error - got (%v) wanted (%v)", "Load", err, nil))
+		}
+		got, err := tx.Normalize("BH-01", "Stop Autorenew")
+		if err != nil || got != CANCELAR {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect label - got (%s, %v) wanted (%s)", "Normalize", got, err, CANCELAR))
+		}
+		if _, err = tx.Normalize("MM-01", "Refund"); err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error for a label of another affiliate - got (%v) wanted (%s)", "Normalize", err, "error"))
+		}
+		if got = tx.Canonical("MM-01", "Refund"); got != "Refund" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect label - got (%s) wanted (%s)", "Canonical", got, "Refund"))
+		}
+	})
+
+	t.Run("Load : should fail (alias to unknown label)", func(t *testing.T) {
+		_, err := Load("../../tests/label-taxonomy-invalid.json")
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Load", err, "error"))
+		}
+	})
+
+	t.Run("Load : should fail (label without a class)", func(t *testing.T) {
+		_, err := Load("../../tests/label-taxonomy-unmapped.json")
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Load", err, "error"))
+		}
+	})
+
+	t.Run("Class : should pass (affiliate label mapped to a class)", func(t *testing.T) {
+		tx, err := Load("../../tests/label-taxonomy.json")
+		if err != nil {
+			t.Fatalf(fmt.Sprintf("Function %s returned with error - got (%v) wanted (%v)", "Load", err, nil))
+		}
+		for in, want := range map[string]string{"refund": CANCEL, "Stop Autorenew": CANCELAR, "No Action": NOACTION, "Unknown": ""} {
+			if got := tx.Class("BH-01", in); got != want {
+				t.Errorf(fmt.Sprintf("Function %s returned incorrect class for %q - got (%s) wanted (%s)", "Class", in, got, want))
+			}
+		}
+	})
+
+	t.Run("Load : should fail (no file)", func(t *testing.T) {
+		_, err := Load("../../tests/does-not-exist.json")
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Load", err, "error"))
+		}
+	})
+
+	t.Run("Init : should pass", func(t *testing.T) {
+		os.Setenv("LABEL_TAXONOMY_FILE", "../../tests/label-taxonomy.json")
+		err := Init(logger)
+		if err != nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with error - got (%v) wanted (%v)", "Init", err, nil))
+		}
+		if len(Get().For("BH-01").Labels) != 4 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect labels - got (%v) wanted (%d)", "Init", Get().For("BH-01").Labels, 4))
+		}
+		os.Setenv("LABEL_TAXONOMY_FILE", "")
+		Set(Default())
+	})
+
+	t.Run("Init : should fail", func(t *testing.T) {
+		os.Setenv("LABEL_TAXONOMY_FILE", "../../tests/label-taxonomy-invalid.json")
+		err := Init(logger)
+		if err == nil {
+			t.Errorf(fmt.Sprintf("Function %s returned with no error - got (%v) wanted (%s)", "Init", err, "error"))
+		}
+		os.Setenv("LABEL_TAXONOMY_FILE", "")
+	})
+}
@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TRACINGENABLED     string = "TRACING_ENABLED"
+	OTLPENDPOINT       string = "OTEL_EXPORTER_OTLP_ENDPOINT"
+	OTLPTRACESENDPOINT string = "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"
+	DEFAULTENDPOINT    string = "localhost:4318"
+	SERVICENAME        string = "servisbot-reportlist-interface"
+	TRACERNAME         string = "gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface"
+	TRACEID            string = "traceId"
+)
+
+// shutdown - flushes and stops the exporter (a no-op while tracing is disabled)
+var shutdown = func(ctx context.Context) error { return nil }
+
+// Init - sets the w3c trace context propagator and (if TRACING_ENABLED is true) exports the spans over otlp/http
+// tracing is off by default, the spans are then no-ops but an incoming traceparent is still passed on
+// the exporter defaults to a local collector (localhost:4318) unless an OTEL_EXPORTER_OTLP_* endpoint is set
+// the sampler can be set with OTEL_TRACES_SAMPLER (the default samples every trace)
+func Init(logger *logging.Logger) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	enabled := false
+	if value := os.Getenv(TRACINGENABLED); value != "" {
+		var err error
+		enabled, err = strconv.ParseBool(value)
+		if err != nil {
+			err = fmt.Errorf("%s must be true or false (%s)", TRACINGENABLED, value)
+			logger.Error(fmt.Sprintf("Tracing : %v", err))
+			return err
+		}
+	}
+	if !enabled {
+		logger.Info("Tracing : disabled")
+		return nil
+	}
+
+	var opts []otlptracehttp.Option
+	if os.Getenv(OTLPENDPOINT) == "" && os.Getenv(OTLPTRACESENDPOINT) == "" {
+		opts = append(opts, otlptracehttp.WithEndpoint(DEFAULTENDPOINT), otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Tracing : %v", err))
+		return err
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(context.Background(), resource.WithAttributes(semconv.ServiceName(SERVICENAME)), resource.WithFromEnv(), resource.WithTelemetrySDK())
+	if err != nil {
+		logger.Error(fmt.Sprintf("Tracing : %v", err))
+		return err
+	}
+
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	shutdown = provider.Shutdown
+	logger.Info("Tracing : exporting spans over otlp/http")
+	return nil
+}
+
+// Shutdown - exports the remaining spans (call before exit)
+func Shutdown(ctx context.Context) error {
+	return shutdown(ctx)
+}
+
+// Start - starts a span (a child of the span in the context, if any)
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return otel.Tracer(TRACERNAME).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End - ends the span, a non nil error is recorded and marks the span as failed
+// pass the address of the error so that it can be deferred before the error is set
+func End(span trace.Span, err *error) {
+	if err != nil && *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
+
+// statusWriter - private type, keeps the response status for the server span
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusWriter) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// Middleware - starts a server span for each request (named by the route template)
+// the w3c traceparent (and baggage) headers of the caller are honoured so the span joins the caller's trace
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := r.URL.Path
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := otel.Tracer(TRACERNAME).Start(ctx, r.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPRequestMethodKey.String(r.Method), semconv.HTTPRoute(route), semconv.URLPath(r.URL.Path)))
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPResponseStatusCode(sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
@@ -0,0 +1,125 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
+	"github.com/gorilla/mux"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// recorder - test helper, installs a provider that keeps the ended spans in memory
+func recorder() *tracetest.SpanRecorder {
+	rec := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	return rec
+}
+
+// attributeValue - test helper, the value of the span attribute ("" if it isn't set)
+func attributeValue(attrs []attribute.KeyValue, key string) string {
+	for _, kv := range attrs {
+		if string(kv.Key) == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+// TestTracing - test entry point
+func TestTracing(t *testing.T) {
+
+	logger := &logging.Logger{Level: "trace"}
+
+	t.Run("Init : should pass (disabled by default)", func(t *testing.T) {
+		os.Unsetenv(TRACINGENABLED)
+		err := Init(logger)
+		if err != nil || Shutdown(context.Background()) != nil {
+			t.Errorf(fmt.Sprintf("Function %s returned an error - got (%v) wanted (%v)", "Init", err, nil))
+		}
+	})
+
+	t.Run("Init : should pass (enabled with the local collector)", func(t *testing.T) {
+		os.Setenv(TRACINGENABLED, "true")
+		defer os.Unsetenv(TRACINGENABLED)
+		err := Init(logger)
+		if err != nil {
+			t.Errorf(fmt.Sprintf("Function %s returned an error - got (%v) wanted (%v)", "Init", err, nil))
+		}
+		Shutdown(context.Background())
+	})
+
+	t.Run("Init : should fail (TRACING_ENABLED is not a boolean)", func(t *testing.T) {
+		os.Setenv(TRACINGENABLED, "sometimes")
+		defer os.Unsetenv(TRACINGENABLED)
+		if err := Init(logger); err == nil {
+			t.Errorf(fmt.Sprintf("Function %s did not return an error - got (%v) wanted (%s)", "Init", err, "error"))
+		}
+	})
+
+	t.Run("Middleware : should pass (joins the caller's trace, named by the route)", func(t *testing.T) {
+		rec := recorder()
+		r := mux.NewRouter()
+		r.Use(Middleware)
+		var child string
+		r.HandleFunc("/api/v1/reports/{id}", func(w http.ResponseWriter, req *http.Request) {
+			_, span := Start(req.Context(), "child")
+			child = span.SpanContext().TraceID().String()
+			span.End()
+			w.WriteHeader(http.StatusNotFound)
+		})
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/api/v1/reports/123", nil)
+		req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		r.ServeHTTP(rr, req)
+
+		spans := rec.Ended()
+		if len(spans) != 2 {
+			t.Fatalf(fmt.Sprintf("Function %s returned incorrect spans - got (%d) wanted (%d)", "Middleware", len(spans), 2))
+		}
+		server := spans[1]
+		if server.Name() != "PATCH /api/v1/reports/{id}" || server.SpanContext().TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" || child != "4bf92f3577b34da6a3ce929d0e0e4736" {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect span - got (%s %s %s) wanted (%s)", "Middleware", server.Name(), server.SpanContext().TraceID(), child, "the caller's trace id"))
+		}
+		if attributeValue(server.Attributes(), "http.response.status_code") != "404" || server.Status().Code == codes.Error {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect status - got (%v %v) wanted (%s)", "Middleware", server.Attributes(), server.Status(), "404 (not an error)"))
+		}
+	})
+
+	t.Run("Middleware : should pass (server errors fail the span)", func(t *testing.T) {
+		rec := recorder()
+		handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}))
+		rr := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/v1/stats", nil)
+		handler.ServeHTTP(rr, req)
+		spans := rec.Ended()
+		if len(spans) != 1 || spans[0].Name() != "POST /api/v1/stats" || spans[0].Status().Code != codes.Error || spans[0].Parent().IsValid() {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect span - got (%v) wanted (%s)", "Middleware", spans, "a failed root span"))
+		}
+	})
+
+	t.Run("End : should pass (the error is recorded)", func(t *testing.T) {
+		rec := recorder()
+		_, ok := Start(nil, "ok")
+		var err error
+		End(ok, &err)
+		_, failed := Start(context.Background(), "failed")
+		err = errors.New("query failed")
+		End(failed, &err)
+		spans := rec.Ended()
+		if len(spans) != 2 || spans[0].Status().Code == codes.Error || spans[1].Status().Code != codes.Error || len(spans[1].Events()) != 1 {
+			t.Errorf(fmt.Sprintf("Function %s returned incorrect spans - got (%v) wanted (%s)", "End", spans, "ok and failed"))
+		}
+	})
+}
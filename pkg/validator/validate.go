@@ -6,11 +6,11 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/microlib/simple"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
 )
 
 // checkEnvars - private function, iterates through each item and checks the required field
-func checkEnvar(item string, logger *simple.Logger) error {
+func checkEnvar(item string, logger *logging.Logger) error {
 	name := strings.Split(item, ",")[0]
 	required, _ := strconv.ParseBool(strings.Split(item, ",")[1])
 	logger.Trace(fmt.Sprintf("Input paramaters -> name %s : required %t", name, required))
@@ -27,13 +27,15 @@ func checkEnvar(item string, logger *simple.Logger) error {
 
 // ValidateEnvars : public call that groups all envar validations
 // These envars are set via the openshift template
-func ValidateEnvars(logger *simple.Logger) error {
+func ValidateEnvars(logger *logging.Logger) error {
 	items := []string{
 		"LOG_LEVEL,false",
 		"SERVER_PORT,true",
 		"VERSION,true",
 		"NAME,true",
 		"URL,true",
+		"INGEST_TOKEN,false",
+		"ADMIN_TOKEN,false",
 	}
 	for x := range items {
 		if err := checkEnvar(items[x], logger); err != nil {
@@ -5,12 +5,12 @@ import (
 	"os"
 	"testing"
 
-	"github.com/microlib/simple"
+	"gitea-devops-shared-threefld-cicd.apps.c4.us-east-1.dev.aws.ocp.14west.io/cicd/servisbot-reportlist-interface/pkg/logging"
 )
 
 // TestEnvars - test entry point
 func TestEnvars(t *testing.T) {
-	logger := &simple.Logger{Level: "trace"}
+	logger := &logging.Logger{Level: "trace"}
 
 	t.Run("ValidateEnvars : should fail", func(t *testing.T) {
 		os.Setenv("SERVER_PORT", "")